@@ -0,0 +1,279 @@
+// Package agent keeps credentials in memory in a separate process, like ssh-agent, so cpush and rcheck don't have to
+// ask for the password every run, and the password isn't left behind in a file.
+//
+// The agent listens on a unix socket that only its own user can use: the socket is in a directory that only the user
+// can enter, and the user of every connection is checked with the peer credentials of the socket where the operating
+// system supports them. Credentials are forgotten when they're older than the TTL, or haven't been used for the idle
+// timeout.
+package agent
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// SocketEnv is the environment variable with the socket of the running agent.
+const SocketEnv = "CPUSH_AUTH_SOCK"
+
+// ErrNotFound is returned when the agent doesn't have a credential.
+var ErrNotFound = errors.New("credential not in agent")
+
+// Credential is a username and password.
+type Credential struct {
+	Username string `json:"username,omitempty"`
+	Password string `json:"password"`
+}
+
+// request is sent by a client, one per connection.
+type request struct {
+	// Op is get, set, remove, remove_all or stop.
+	Op         string      `json:"op"`
+	Name       string      `json:"name,omitempty"`
+	Credential *Credential `json:"credential,omitempty"`
+}
+
+// response is the answer of the agent to a request.
+type response struct {
+	Credential *Credential `json:"credential,omitempty"`
+	NotFound   bool        `json:"not_found,omitempty"`
+	Error      string      `json:"error,omitempty"`
+}
+
+// DefaultSocket returns where the agent listens if no socket is given: in $XDG_RUNTIME_DIR, or in a directory of the
+// user in the temporary directory.
+func DefaultSocket() string {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, "cpush-agent.sock")
+	}
+	return filepath.Join(os.TempDir(), fmt.Sprintf("cpush-%d", os.Getuid()), "agent.sock")
+}
+
+// entry is a credential held by the agent. The password is kept as bytes, so it can be overwritten when it's
+// forgotten.
+type entry struct {
+	username string
+	password []byte
+	added    time.Time
+	used     time.Time
+}
+
+func (e *entry) wipe() {
+	for i := range e.password {
+		e.password[i] = 0
+	}
+}
+
+// Server holds credentials for clients. It's safe for concurrent use.
+type Server struct {
+	// TTL is how long a credential is held after it was added, 0 for forever.
+	TTL time.Duration
+	// IdleTimeout is how long a credential is held after it was last used, 0 for forever.
+	IdleTimeout time.Duration
+	// Logf logs refused connections and forgotten credentials, if it's set.
+	Logf func(format string, args ...interface{})
+
+	now func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*entry
+	stop    chan struct{}
+}
+
+// NewServer returns a server that forgets credentials after ttl, or after they weren't used for idleTimeout.
+func NewServer(ttl time.Duration, idleTimeout time.Duration) *Server {
+	return &Server{
+		TTL:         ttl,
+		IdleTimeout: idleTimeout,
+		now:         time.Now,
+		entries:     map[string]*entry{},
+		stop:        make(chan struct{}),
+	}
+}
+
+func (s *Server) logf(format string, args ...interface{}) {
+	if s.Logf != nil {
+		s.Logf(format, args...)
+	}
+}
+
+// Listen listens on a unix socket, in a directory that only the current user can use. A socket left behind by an
+// agent that isn't running anymore is removed.
+func Listen(socket string) (net.Listener, error) {
+	dir := filepath.Dir(socket)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create directory for agent socket: %v", err)
+	}
+	if fi, err := os.Stat(dir); err != nil {
+		return nil, err
+	} else if fi.Mode().Perm()&0077 != 0 {
+		return nil, fmt.Errorf("directory %q of agent socket can be used by other users, its mode is %v", dir, fi.Mode().Perm())
+	}
+
+	if conn, err := net.Dial("unix", socket); err == nil {
+		conn.Close()
+		return nil, fmt.Errorf("an agent is already listening on %q", socket)
+	}
+	if err := os.Remove(socket); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to remove old agent socket: %v", err)
+	}
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(socket, 0600); err != nil {
+		l.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// Serve answers the clients that connect to l, until it's closed, or a client asks the agent to stop. All credentials
+// are forgotten when it returns.
+func (s *Server) Serve(l net.Listener) error {
+	defer s.removeAll()
+
+	go func() {
+		<-s.stop
+		l.Close()
+	}()
+	go s.expireLoop()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			select {
+			case <-s.stop:
+				return nil
+			default:
+			}
+			return err
+		}
+		go s.handle(conn)
+	}
+}
+
+// Stop makes Serve return.
+func (s *Server) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	select {
+	case <-s.stop:
+	default:
+		close(s.stop)
+	}
+}
+
+// expireLoop forgets expired credentials, so they aren't kept in memory until they're asked for.
+func (s *Server) expireLoop() {
+	t := time.NewTicker(10 * time.Second)
+	defer t.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-t.C:
+			s.mu.Lock()
+			s.expire()
+			s.mu.Unlock()
+		}
+	}
+}
+
+// expire forgets the credentials that are too old or weren't used for too long. The caller must hold the lock.
+func (s *Server) expire() {
+	now := s.now()
+	for name, e := range s.entries {
+		if (s.TTL > 0 && now.Sub(e.added) >= s.TTL) || (s.IdleTimeout > 0 && now.Sub(e.used) >= s.IdleTimeout) {
+			e.wipe()
+			delete(s.entries, name)
+			s.logf("forgot expired credential %q", name)
+		}
+	}
+}
+
+func (s *Server) removeAll() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for name, e := range s.entries {
+		e.wipe()
+		delete(s.entries, name)
+	}
+}
+
+func (s *Server) handle(conn net.Conn) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+	if err := checkPeer(conn); err != nil {
+		s.logf("refused connection: %v", err)
+		return
+	}
+
+	var req request
+	if err := json.NewDecoder(bufio.NewReader(conn)).Decode(&req); err != nil {
+		s.logf("failed to read request: %v", err)
+		return
+	}
+	resp := s.do(req)
+	if err := json.NewEncoder(conn).Encode(resp); err != nil {
+		s.logf("failed to send response: %v", err)
+	}
+}
+
+// do answers a request.
+func (s *Server) do(req request) response {
+	if req.Op == "stop" {
+		s.Stop()
+		return response{}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expire()
+
+	switch req.Op {
+	case "get":
+		e, ok := s.entries[req.Name]
+		if !ok {
+			return response{NotFound: true}
+		}
+		e.used = s.now()
+		return response{Credential: &Credential{Username: e.username, Password: string(e.password)}}
+	case "set":
+		if req.Name == "" || req.Credential == nil {
+			return response{Error: "set needs a name and a credential"}
+		}
+		if old, ok := s.entries[req.Name]; ok {
+			old.wipe()
+		}
+		now := s.now()
+		s.entries[req.Name] = &entry{
+			username: req.Credential.Username,
+			password: []byte(req.Credential.Password),
+			added:    now,
+			used:     now,
+		}
+		return response{}
+	case "remove":
+		if e, ok := s.entries[req.Name]; ok {
+			e.wipe()
+			delete(s.entries, req.Name)
+		}
+		return response{}
+	case "remove_all":
+		for name, e := range s.entries {
+			e.wipe()
+			delete(s.entries, name)
+		}
+		return response{}
+	default:
+		return response{Error: fmt.Sprintf("unknown operation %q", req.Op)}
+	}
+}
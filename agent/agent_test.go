@@ -0,0 +1,134 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+)
+
+// fakeClock is a clock that only moves when told to.
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func startAgent(t *testing.T, ttl time.Duration, idleTimeout time.Duration) (*Client, *fakeClock, chan error) {
+	t.Helper()
+	socket := filepath.Join(t.TempDir(), "agent", "agent.sock")
+	l, err := Listen(socket)
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	s := NewServer(ttl, idleTimeout)
+	s.now = clock.Now
+	done := make(chan error, 1)
+	go func() { done <- s.Serve(l) }()
+	t.Cleanup(s.Stop)
+	return &Client{Socket: socket}, clock, done
+}
+
+func TestAgent(t *testing.T) {
+	c, _, _ := startAgent(t, 0, 0)
+	ctx := context.Background()
+
+	if _, err := c.Get(ctx, "default"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("got %v, want ErrNotFound", err)
+	}
+	if err := c.Set(ctx, "default", Credential{Password: "hunter2"}); err != nil {
+		t.Fatalf("failed to set: %v", err)
+	}
+	if err := c.Set(ctx, "core-admin", Credential{"breakglass", "s3cret"}); err != nil {
+		t.Fatalf("failed to set: %v", err)
+	}
+	got, err := c.Get(ctx, "core-admin")
+	if err != nil {
+		t.Fatalf("failed to get: %v", err)
+	}
+	if diff := deep.Equal(got, Credential{"breakglass", "s3cret"}); diff != nil {
+		t.Error(diff)
+	}
+
+	if err := c.Remove(ctx, "core-admin"); err != nil {
+		t.Fatalf("failed to remove: %v", err)
+	}
+	if _, err := c.Get(ctx, "core-admin"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("got %v after remove, want ErrNotFound", err)
+	}
+	if err := c.RemoveAll(ctx); err != nil {
+		t.Fatalf("failed to remove all: %v", err)
+	}
+	if _, err := c.Get(ctx, "default"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("got %v after remove all, want ErrNotFound", err)
+	}
+}
+
+func TestExpiry(t *testing.T) {
+	c, clock, _ := startAgent(t, time.Hour, 10*time.Minute)
+	ctx := context.Background()
+
+	if err := c.Set(ctx, "default", Credential{Password: "hunter2"}); err != nil {
+		t.Fatalf("failed to set: %v", err)
+	}
+	// Using the credential every 9 minutes keeps it from idling out, until the TTL is reached.
+	for elapsed := 9 * time.Minute; elapsed < time.Hour; elapsed += 9 * time.Minute {
+		clock.Advance(9 * time.Minute)
+		if _, err := c.Get(ctx, "default"); err != nil {
+			t.Fatalf("after %v: %v", elapsed, err)
+		}
+	}
+	clock.Advance(9 * time.Minute)
+	if _, err := c.Get(ctx, "default"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("got %v after the TTL, want ErrNotFound", err)
+	}
+
+	if err := c.Set(ctx, "default", Credential{Password: "hunter2"}); err != nil {
+		t.Fatalf("failed to set: %v", err)
+	}
+	clock.Advance(10 * time.Minute)
+	if _, err := c.Get(ctx, "default"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("got %v after the idle timeout, want ErrNotFound", err)
+	}
+}
+
+func TestStop(t *testing.T) {
+	c, _, done := startAgent(t, 0, 0)
+	if err := c.Stop(context.Background()); err != nil {
+		t.Fatalf("failed to stop: %v", err)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Serve returned %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("agent didn't stop")
+	}
+	if _, err := c.Get(context.Background(), "default"); err == nil {
+		t.Errorf("expected an error from a stopped agent")
+	}
+}
+
+func TestListenInUse(t *testing.T) {
+	c, _, _ := startAgent(t, 0, 0)
+	if _, err := Listen(c.Socket); err == nil {
+		t.Errorf("expected an error when an agent already listens")
+	}
+}
@@ -0,0 +1,75 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+)
+
+// Client talks to an agent.
+type Client struct {
+	// Socket is the unix socket the agent listens on.
+	Socket string
+}
+
+// call sends a request to the agent and returns its response.
+func (c *Client) call(ctx context.Context, req request) (response, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "unix", c.Socket)
+	if err != nil {
+		return response{}, fmt.Errorf("failed to connect to agent: %v", err)
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return response{}, fmt.Errorf("failed to send request to agent: %v", err)
+	}
+	var resp response
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		return response{}, fmt.Errorf("failed to read response from agent: %v", err)
+	}
+	if resp.Error != "" {
+		return response{}, fmt.Errorf("agent: %s", resp.Error)
+	}
+	return resp, nil
+}
+
+// Get returns a credential, or ErrNotFound if the agent doesn't have it, or it expired.
+func (c *Client) Get(ctx context.Context, name string) (Credential, error) {
+	resp, err := c.call(ctx, request{Op: "get", Name: name})
+	if err != nil {
+		return Credential{}, err
+	}
+	if resp.NotFound || resp.Credential == nil {
+		return Credential{}, fmt.Errorf("%w: %q", ErrNotFound, name)
+	}
+	return *resp.Credential, nil
+}
+
+// Set adds or replaces a credential. Its TTL starts now.
+func (c *Client) Set(ctx context.Context, name string, cred Credential) error {
+	_, err := c.call(ctx, request{Op: "set", Name: name, Credential: &cred})
+	return err
+}
+
+// Remove makes the agent forget a credential.
+func (c *Client) Remove(ctx context.Context, name string) error {
+	_, err := c.call(ctx, request{Op: "remove", Name: name})
+	return err
+}
+
+// RemoveAll makes the agent forget all credentials.
+func (c *Client) RemoveAll(ctx context.Context) error {
+	_, err := c.call(ctx, request{Op: "remove_all"})
+	return err
+}
+
+// Stop makes the agent forget all credentials and exit.
+func (c *Client) Stop(ctx context.Context) error {
+	_, err := c.call(ctx, request{Op: "stop"})
+	return err
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package agent
+
+import "net"
+
+// checkPeer accepts every connection. Only the permissions of the socket and its directory keep other users out.
+func checkPeer(conn net.Conn) error {
+	return nil
+}
@@ -0,0 +1,210 @@
+// Package audit keeps a record of every push: who pushed what to which device, when, and how it went.
+//
+// Records are appended to a file as one JSON object per line, or sent to syslog. Records in a file can be listed
+// again with Query.
+package audit
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/syslog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Outcomes of a push.
+const (
+	Succeeded = "succeeded"
+	// Rejected means the device rejected lines of the configlet.
+	Rejected = "rejected"
+	// Reverted means the configlet was rolled back or reverted, because it was rejected or a verification failed.
+	Reverted = "reverted"
+	Failed   = "failed"
+)
+
+// RejectedLine is a line of the configlet that the device rejected.
+type RejectedLine struct {
+	LineNumber int    `json:"line_number,omitempty"`
+	Line       string `json:"line"`
+	Message    string `json:"message"`
+}
+
+// Record is a single push attempt on a device.
+type Record struct {
+	Start           time.Time      `json:"start"`
+	End             time.Time      `json:"end"`
+	Operator        string         `json:"operator"`
+	Device          string         `json:"device"`
+	Configlet       string         `json:"configlet"`
+	ConfigletSHA256 string         `json:"configlet_sha256"`
+	Outcome         string         `json:"outcome"`
+	Error           string         `json:"error,omitempty"`
+	Rejected        []RejectedLine `json:"rejected,omitempty"`
+	// PreConfigSHA256 and PostConfigSHA256 are the hashes of the running config before and after the push, if they
+	// were taken, see ConfigHash.
+	PreConfigSHA256  string `json:"pre_config_sha256,omitempty"`
+	PostConfigSHA256 string `json:"post_config_sha256,omitempty"`
+}
+
+// volatileLines are lines in the running config that change without the configuration changing.
+var volatileLines = []string{
+	"Building configuration",
+	"Current configuration",
+	"! Last configuration change",
+	"! NVRAM config last updated",
+	"! No configuration change since last restart",
+	"ntp clock-period",
+}
+
+// ConfigHash returns the hash of the output of show running-config, without the lines that change by themselves,
+// like the time of the last change.
+func ConfigHash(runningConfig string) string {
+	var lines []string
+	for _, line := range strings.Split(strings.ReplaceAll(runningConfig, "\r", ""), "\n") {
+		volatile := false
+		for _, v := range volatileLines {
+			if strings.HasPrefix(strings.TrimSpace(line), v) {
+				volatile = true
+				break
+			}
+		}
+		if !volatile {
+			lines = append(lines, line)
+		}
+	}
+	sum := sha256.Sum256([]byte(strings.TrimSpace(strings.Join(lines, "\n"))))
+	return hex.EncodeToString(sum[:])
+}
+
+// Log records pushes. It's safe for concurrent use.
+type Log struct {
+	mu     sync.Mutex
+	f      *os.File
+	syslog *syslog.Writer
+}
+
+// Open opens an audit log: syslog or syslog:TAG for the local syslog, or a file that the records are appended to.
+func Open(spec string) (*Log, error) {
+	if spec == "syslog" || strings.HasPrefix(spec, "syslog:") {
+		tag := strings.TrimPrefix(strings.TrimPrefix(spec, "syslog"), ":")
+		if tag == "" {
+			tag = "cpush"
+		}
+		w, err := syslog.New(syslog.LOG_NOTICE|syslog.LOG_USER, tag)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to syslog: %v", err)
+		}
+		return &Log{syslog: w}, nil
+	}
+
+	fn := expandHome(spec)
+	if err := os.MkdirAll(filepath.Dir(fn), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create directory for audit log: %v", err)
+	}
+	f, err := os.OpenFile(fn, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log %q: %v", fn, err)
+	}
+	return &Log{f: f}, nil
+}
+
+// Write adds a record to the log.
+func (l *Log) Write(r Record) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.syslog != nil {
+		return l.syslog.Notice(string(data))
+	}
+	if _, err := l.f.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write to audit log %q: %v", l.f.Name(), err)
+	}
+	return nil
+}
+
+// Close closes the log.
+func (l *Log) Close() error {
+	if l.syslog != nil {
+		return l.syslog.Close()
+	}
+	return l.f.Close()
+}
+
+// Filter selects records. Empty fields match everything.
+type Filter struct {
+	Device   string
+	Operator string
+}
+
+// ParseFilter parses a filter like device:NAME or user:NAME. all matches all records.
+func ParseFilter(s string) (Filter, error) {
+	if s == "all" {
+		return Filter{}, nil
+	}
+	kind, value, ok := strings.Cut(s, ":")
+	if ok && value != "" {
+		switch kind {
+		case "device":
+			return Filter{Device: value}, nil
+		case "user":
+			return Filter{Operator: value}, nil
+		}
+	}
+	return Filter{}, fmt.Errorf("invalid audit query %q, want device:NAME, user:NAME or all", s)
+}
+
+func (f Filter) match(r Record) bool {
+	return (f.Device == "" || r.Device == f.Device) && (f.Operator == "" || r.Operator == f.Operator)
+}
+
+// Query returns the most recent records in an audit log file that match the filter, newest first. limit is the most
+// records to return, 0 for all of them.
+func Query(fn string, f Filter, limit int) ([]Record, error) {
+	file, err := os.Open(expandHome(fn))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %v", err)
+	}
+	defer file.Close()
+
+	var result []Record
+	s := bufio.NewScanner(file)
+	s.Buffer(nil, 16*1024*1024)
+	for line := 1; s.Scan(); line++ {
+		var r Record
+		if err := json.Unmarshal(s.Bytes(), &r); err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", fn, line, err)
+		}
+		if f.match(r) {
+			result = append(result, r)
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+
+	for i, j := 0, len(result)-1; i < j; i, j = i+1, j-1 {
+		result[i], result[j] = result[j], result[i]
+	}
+	if limit > 0 && len(result) > limit {
+		result = result[:limit]
+	}
+	return result, nil
+}
+
+func expandHome(fn string) string {
+	if strings.HasPrefix(fn, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, fn[2:])
+		}
+	}
+	return fn
+}
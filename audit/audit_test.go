@@ -0,0 +1,79 @@
+package audit
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+)
+
+func TestLogAndQuery(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "audit", "audit.jsonl")
+	l, err := Open(fn)
+	if err != nil {
+		t.Fatalf("failed to open: %v", err)
+	}
+	start := time.Date(2024, 1, 5, 10, 0, 0, 0, time.UTC)
+	records := []Record{
+		{Start: start, End: start.Add(time.Minute), Operator: "alice", Device: "rtr1", Outcome: Succeeded},
+		{Start: start.Add(time.Hour), Operator: "bob", Device: "rtr1", Outcome: Rejected, Rejected: []RejectedLine{
+			{LineNumber: 2, Line: "ntp server x", Message: "% Invalid input detected at '^' marker."},
+		}},
+		{Start: start.Add(2 * time.Hour), Operator: "alice", Device: "rtr2", Outcome: Failed, Error: "timeout"},
+	}
+	for _, r := range records {
+		if err := l.Write(r); err != nil {
+			t.Fatalf("failed to write: %v", err)
+		}
+	}
+	if err := l.Close(); err != nil {
+		t.Fatalf("failed to close: %v", err)
+	}
+
+	for _, test := range []struct {
+		query string
+		limit int
+		want  []Record
+	}{
+		{"all", 0, []Record{records[2], records[1], records[0]}},
+		{"all", 2, []Record{records[2], records[1]}},
+		{"device:rtr1", 0, []Record{records[1], records[0]}},
+		{"user:alice", 0, []Record{records[2], records[0]}},
+		{"user:carol", 0, nil},
+	} {
+		f, err := ParseFilter(test.query)
+		if err != nil {
+			t.Errorf("failed to parse %q: %v", test.query, err)
+			continue
+		}
+		got, err := Query(fn, f, test.limit)
+		if err != nil {
+			t.Errorf("failed to query %q: %v", test.query, err)
+			continue
+		}
+		if diff := deep.Equal(got, test.want); diff != nil {
+			t.Errorf("%s: %v", test.query, diff)
+		}
+	}
+}
+
+func TestParseFilterInvalid(t *testing.T) {
+	for _, s := range []string{"", "rtr1", "device:", "site:ams"} {
+		if _, err := ParseFilter(s); err == nil {
+			t.Errorf("ParseFilter(%q): expected an error", s)
+		}
+	}
+}
+
+func TestConfigHash(t *testing.T) {
+	before := "Building configuration...\r\n\r\nCurrent configuration : 1234 bytes\r\n!\r\n! Last configuration change at 10:00:00 UTC Fri Jan 5 2024\r\n!\r\nhostname rtr1\r\n"
+	later := "Building configuration...\n\nCurrent configuration : 1240 bytes\n!\n! Last configuration change at 11:00:00 UTC Fri Jan 5 2024\n!\nhostname rtr1\n"
+	changed := "Building configuration...\n\nCurrent configuration : 1240 bytes\n!\nhostname rtr2\n"
+	if ConfigHash(before) != ConfigHash(later) {
+		t.Errorf("hash changed without a configuration change")
+	}
+	if ConfigHash(before) == ConfigHash(changed) {
+		t.Errorf("hash didn't change with the configuration")
+	}
+}
@@ -3,14 +3,65 @@ package checks
 import (
 	"fmt"
 	"strconv"
+	"strings"
 
 	"github.com/cdevr/cpush/textfsm"
+	"github.com/cdevr/cpush/utils"
 )
 
+// Severity indicates how serious a check result is.
+type Severity int
+
+const (
+	Info Severity = iota
+	Warning
+	Critical
+)
+
+var severityNames = []string{"info", "warning", "critical"}
+
+func (s Severity) String() string {
+	if s < 0 || int(s) >= len(severityNames) {
+		return fmt.Sprintf("severity(%d)", int(s))
+	}
+	return severityNames[s]
+}
+
+// ParseSeverity parses a severity name such as "warning" into a Severity.
+func ParseSeverity(s string) (Severity, error) {
+	for i, name := range severityNames {
+		if strings.EqualFold(s, name) {
+			return Severity(i), nil
+		}
+	}
+	return Info, fmt.Errorf("unknown severity %q, expected one of %s", s, strings.Join(severityNames, ", "))
+}
+
+// CheckResult is a single finding of a check on a device. Fields contains the
+// structured data the finding is based on, such as the interface name and the
+// counter that was found to be nonzero.
 type CheckResult struct {
 	CheckName string
 	Device    string
 	Result    string
+	Severity  Severity
+	Fields    map[string]string
+}
+
+// CheckStatus is the outcome of a single check on a single device. A check is
+// OK when none of its results are a warning or worse.
+type CheckStatus struct {
+	CheckName string
+	Device    string
+	OK        bool
+	Severity  Severity
+}
+
+func (cs CheckStatus) String() string {
+	if cs.OK {
+		return "OK"
+	}
+	return fmt.Sprintf("NOTOK (%s)", cs.Severity)
 }
 
 type CheckData struct {
@@ -30,12 +81,52 @@ var Checks = []CheckData{
 		[]string{"show bgp sum"},
 		CheckBgpSum,
 	},
-	// TODO:
-	// Check bootvar is set to 0x2102
-	// Check BFD
-	// Check interface transceiver
-	// Check license all
-	// Check standby HSRP
+	{
+		"Boot variables",
+		[]string{"show bootvar"},
+		CheckBootvar,
+	},
+	{
+		"BFD sessions",
+		[]string{"show bfd neighbors"},
+		CheckBfd,
+	},
+	{
+		"Transceivers",
+		[]string{"show interfaces transceiver"},
+		CheckTransceivers,
+	},
+	{
+		"Licenses",
+		[]string{"show license all"},
+		CheckLicenses,
+	},
+	{
+		"HSRP",
+		[]string{"show standby"},
+		CheckHsrp,
+	},
+}
+
+// ThresholdConfig contains the limits the checks compare against.
+type ThresholdConfig struct {
+	// ConfigRegister is the expected configuration register.
+	ConfigRegister string
+
+	// Transceiver optical power limits in dBm. Going below the low or above the high limit is critical.
+	TxPowerLow  float64
+	TxPowerHigh float64
+	RxPowerLow  float64
+	RxPowerHigh float64
+}
+
+// Thresholds are the limits used by the checks. Change them before running the checks to use different limits.
+var Thresholds = ThresholdConfig{
+	ConfigRegister: "0x2102",
+	TxPowerLow:     -10,
+	TxPowerHigh:    5,
+	RxPowerLow:     -20,
+	RxPowerHigh:    5,
 }
 
 func GetCheckCommands() []string {
@@ -46,16 +137,54 @@ func GetCheckCommands() []string {
 	return result
 }
 
-func Check(device string, cmdResults map[string]string) ([]CheckResult, error) {
+// Check runs all checks against the command output of a device. It returns
+// all the results, and the status of every check.
+func Check(device string, cmdResults map[string]string) ([]CheckResult, []CheckStatus, error) {
 	var result []CheckResult
+	var statuses []CheckStatus
 	for _, c := range Checks {
 		checkResults, err := c.F(device, cmdResults)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 		result = append(result, checkResults...)
+		statuses = append(statuses, Status(c.Name, device, checkResults))
+	}
+	return result, statuses, nil
+}
+
+// Status determines the status of a check from its results.
+func Status(checkName string, device string, results []CheckResult) CheckStatus {
+	status := CheckStatus{checkName, device, true, Info}
+	for _, r := range results {
+		if r.Severity > status.Severity {
+			status.Severity = r.Severity
+		}
+	}
+	status.OK = status.Severity < Warning
+	return status
+}
+
+// Filter returns only the results with at least the given severity.
+func Filter(results []CheckResult, minSeverity Severity) []CheckResult {
+	var filtered []CheckResult
+	for _, r := range results {
+		if r.Severity >= minSeverity {
+			filtered = append(filtered, r)
+		}
+	}
+	return filtered
+}
+
+// counterResult creates a result for an interface counter that should be zero.
+func counterResult(checkName string, router string, intf string, counter string, value string, description string) CheckResult {
+	return CheckResult{
+		CheckName: checkName,
+		Device:    router,
+		Result:    fmt.Sprintf("%s: %s %s", intf, value, description),
+		Severity:  Warning,
+		Fields:    map[string]string{"interface": intf, "counter": counter, "value": value},
 	}
-	return result, nil
 }
 
 func CheckInterfaces(router string, cmdResults map[string]string) ([]CheckResult, error) {
@@ -64,7 +193,7 @@ func CheckInterfaces(router string, cmdResults map[string]string) ([]CheckResult
 	checkName := "CheckInterfaces"
 
 	if _, ok := cmdResults["show interfaces"]; !ok {
-		return []CheckResult{{checkName, router, "failed to get 'show interfaces' command output"}}, nil
+		return []CheckResult{{checkName, router, "failed to get 'show interfaces' command output", Critical, nil}}, nil
 	}
 
 	interfaceResults, err := textfsm.ParseTypedCiscoIosShowInterfaces(cmdResults["show interfaces"])
@@ -72,35 +201,44 @@ func CheckInterfaces(router string, cmdResults map[string]string) ([]CheckResult
 		return nil, fmt.Errorf("couldnt parse interfaces result")
 	}
 
+	policy := CurrentPolicy.Device(router)
+
 	for _, ir := range interfaceResults {
 		switch {
 		// ok cases
 		case ir.LinkStatus == "up" && ir.ProtocolStatus == "up":
 		case ir.LinkStatus == "administratively down" && ir.ProtocolStatus == "down":
 		default:
-			results = append(results, CheckResult{checkName, router, fmt.Sprintf("%s: admin %q protocol %q", ir.Intf, ir.LinkStatus, ir.ProtocolStatus)})
+			severity := Critical
+			if policy.InterfaceAllowedDown(ir.Intf) {
+				severity = Info
+			}
+			results = append(results, CheckResult{
+				CheckName: checkName,
+				Device:    router,
+				Result:    fmt.Sprintf("%s: admin %q protocol %q", ir.Intf, ir.LinkStatus, ir.ProtocolStatus),
+				Severity:  severity,
+				Fields:    map[string]string{"interface": ir.Intf, "link_status": ir.LinkStatus, "protocol_status": ir.ProtocolStatus},
+			})
 		}
 
-		if ir.Runts != "" && ir.Runts != "0" {
-			results = append(results, CheckResult{checkName, router, fmt.Sprintf("%s: %s runts", ir.Intf, ir.Runts)})
+		counters := []struct {
+			name        string
+			value       string
+			description string
+		}{
+			{"runts", ir.Runts, "runts"},
+			{"giants", ir.Giants, "giants"},
+			{"input_errors", ir.InputErrors, "input errors"},
+			{"crc", ir.Crc, "CRC errors"},
+			{"overrun", ir.Overrun, "frame overruns"},
+			{"abort", ir.Abort, "abort errors"},
+			{"output_errors", ir.OutputErrors, "output errors"},
 		}
-		if ir.Giants != "" && ir.Giants != "0" {
-			results = append(results, CheckResult{checkName, router, fmt.Sprintf("%s: %s giants", ir.Intf, ir.Giants)})
-		}
-		if ir.InputErrors != "" && ir.InputErrors != "0" {
-			results = append(results, CheckResult{checkName, router, fmt.Sprintf("%s: %s input errors", ir.Intf, ir.InputErrors)})
-		}
-		if ir.Crc != "" && ir.Crc != "0" {
-			results = append(results, CheckResult{checkName, router, fmt.Sprintf("%s: %s CRC errors", ir.Intf, ir.Crc)})
-		}
-		if ir.Overrun != "" && ir.Overrun != "0" {
-			results = append(results, CheckResult{checkName, router, fmt.Sprintf("%s: %s frame overruns", ir.Intf, ir.Overrun)})
-		}
-		if ir.Abort != "" && ir.Abort != "0" {
-			results = append(results, CheckResult{checkName, router, fmt.Sprintf("%s: %s abort errors", ir.Intf, ir.Abort)})
-		}
-		if ir.OutputErrors != "" && ir.OutputErrors != "0" {
-			results = append(results, CheckResult{checkName, router, fmt.Sprintf("%s: %s output errors", ir.Intf, ir.OutputErrors)})
+		for _, c := range counters {
+			if c.value != "" && c.value != "0" {
+				results = append(results, counterResult(checkName, router, ir.Intf, c.name, c.value, c.description))
+			}
 		}
 	}
 	return results, nil
@@ -112,7 +250,7 @@ func CheckBgpSum(router string, cmdResults map[string]string) ([]CheckResult, er
 	checkName := "CheckBgpSum"
 
 	if _, ok := cmdResults["show bgp sum"]; !ok {
-		return []CheckResult{{checkName, router, "failed to get 'show bgp sum' command output"}}, nil
+		return []CheckResult{{checkName, router, "failed to get 'show bgp sum' command output", Critical, nil}}, nil
 	}
 
 	bgpSum, err := textfsm.ParseTypedCiscoIosShowBgpSummary(cmdResults["show bgp sum"])
@@ -120,10 +258,245 @@ func CheckBgpSum(router string, cmdResults map[string]string) ([]CheckResult, er
 		return nil, fmt.Errorf("couldnt parse show bgp sum result")
 	}
 
+	policy := CurrentPolicy.Device(router)
+
+	seen := map[string]bool{}
 	for _, neighbor := range bgpSum {
-		// Neighbor status should be the number of prefixes received. If it's anything else ("Idle", or "Connect", or "Active"), that's bad.
-		if _, err := strconv.Atoi(neighbor.Status); err == nil {
-			results = append(results, CheckResult{checkName, router, fmt.Sprintf("%s: idle status %q", neighbor.RemoteIp, neighbor.Status)})
+		seen[neighbor.RemoteIp] = true
+		neighborPolicy, expected := policy.BgpNeighbors[neighbor.RemoteIp]
+		fields := map[string]string{"neighbor": neighbor.RemoteIp, "remote_as": neighbor.RemoteAs, "status": neighbor.Status, "uptime": neighbor.Uptime, "prefixes": neighbor.ReceivedV4}
+
+		// Established neighbors show the number of prefixes received. If it's anything else ("Idle", or "Connect", or "Active"), that's bad.
+		prefixes, err := strconv.Atoi(neighbor.ReceivedV4)
+		if err != nil {
+			severity := Critical
+			if neighborPolicy.AllowedDown {
+				severity = Info
+			}
+			results = append(results, CheckResult{checkName, router, fmt.Sprintf("%s: idle status %q", neighbor.RemoteIp, neighbor.Status), severity, fields})
+			continue
+		}
+
+		if uptime, err := ParseUptime(neighbor.Uptime); err == nil && uptime < CurrentPolicy.MinBgpUptime {
+			results = append(results, CheckResult{checkName, router, fmt.Sprintf("%s: flapping, established for only %s", neighbor.RemoteIp, neighbor.Uptime), Warning, fields})
+		}
+
+		if expected && prefixes < neighborPolicy.MinPrefixes {
+			fields["min_prefixes"] = strconv.Itoa(neighborPolicy.MinPrefixes)
+			results = append(results, CheckResult{checkName, router, fmt.Sprintf("%s: received %d prefixes, expected at least %d", neighbor.RemoteIp, prefixes, neighborPolicy.MinPrefixes), Warning, fields})
+		}
+	}
+
+	for _, neighbor := range utils.SortedKeys(policy.BgpNeighbors) {
+		if seen[neighbor] || policy.BgpNeighbors[neighbor].AllowedDown {
+			continue
+		}
+		results = append(results, CheckResult{checkName, router, fmt.Sprintf("%s: expected neighbor missing", neighbor), Critical, map[string]string{"neighbor": neighbor}})
+	}
+
+	return results, nil
+}
+
+func CheckBootvar(router string, cmdResults map[string]string) ([]CheckResult, error) {
+	var results []CheckResult
+
+	checkName := "CheckBootvar"
+
+	if _, ok := cmdResults["show bootvar"]; !ok {
+		return []CheckResult{{checkName, router, "failed to get 'show bootvar' command output", Critical, nil}}, nil
+	}
+
+	bootvars, err := textfsm.ParseTypedCiscoIosShowBootvar(cmdResults["show bootvar"])
+	if err != nil {
+		return nil, fmt.Errorf("couldnt parse show bootvar result")
+	}
+
+	for _, bv := range bootvars {
+		if bv.ConfigRegister != "" && bv.ConfigRegister != Thresholds.ConfigRegister {
+			results = append(results, CheckResult{
+				CheckName: checkName,
+				Device:    router,
+				Result:    fmt.Sprintf("configuration register is %s, expected %s", bv.ConfigRegister, Thresholds.ConfigRegister),
+				Severity:  Warning,
+				Fields:    map[string]string{"config_register": bv.ConfigRegister, "expected": Thresholds.ConfigRegister},
+			})
+		}
+		// The configuration register that will be used after a reload matters just as much.
+		if bv.NextConfigRegister != "" && bv.NextConfigRegister != Thresholds.ConfigRegister {
+			results = append(results, CheckResult{
+				CheckName: checkName,
+				Device:    router,
+				Result:    fmt.Sprintf("configuration register will be %s at next reload, expected %s", bv.NextConfigRegister, Thresholds.ConfigRegister),
+				Severity:  Warning,
+				Fields:    map[string]string{"next_config_register": bv.NextConfigRegister, "expected": Thresholds.ConfigRegister},
+			})
+		}
+	}
+
+	return results, nil
+}
+
+func CheckBfd(router string, cmdResults map[string]string) ([]CheckResult, error) {
+	var results []CheckResult
+
+	checkName := "CheckBfd"
+
+	if _, ok := cmdResults["show bfd neighbors"]; !ok {
+		return []CheckResult{{checkName, router, "failed to get 'show bfd neighbors' command output", Critical, nil}}, nil
+	}
+
+	sessions, err := textfsm.ParseTypedCiscoIosShowBfdNeighbor(cmdResults["show bfd neighbors"])
+	if err != nil {
+		return nil, fmt.Errorf("couldnt parse show bfd neighbors result")
+	}
+
+	for _, session := range sessions {
+		if session.State != "Up" || session.RhRs != "Up" {
+			results = append(results, CheckResult{
+				CheckName: checkName,
+				Device:    router,
+				Result:    fmt.Sprintf("%s on %s: state %q remote state %q", session.Neighbor, session.Interface, session.State, session.RhRs),
+				Severity:  Critical,
+				Fields:    map[string]string{"neighbor": session.Neighbor, "interface": session.Interface, "state": session.State, "remote_state": session.RhRs},
+			})
+		}
+	}
+
+	return results, nil
+}
+
+// flagSeverity converts the alarm flag next to a transceiver value to a severity.
+func flagSeverity(flag string) Severity {
+	switch flag {
+	case "++", "--":
+		return Critical
+	case "+", "-":
+		return Warning
+	}
+	return Info
+}
+
+// powerSeverity determines the severity of an optical power level, from the alarm flag the device printed, and from
+// the thresholds.
+func powerSeverity(power string, flag string, low float64, high float64) Severity {
+	severity := flagSeverity(flag)
+	if value, err := strconv.ParseFloat(power, 64); err == nil && (value < low || value > high) {
+		severity = Critical
+	}
+	return severity
+}
+
+func CheckTransceivers(router string, cmdResults map[string]string) ([]CheckResult, error) {
+	var results []CheckResult
+
+	checkName := "CheckTransceivers"
+
+	if _, ok := cmdResults["show interfaces transceiver"]; !ok {
+		return []CheckResult{{checkName, router, "failed to get 'show interfaces transceiver' command output", Critical, nil}}, nil
+	}
+
+	transceivers, err := textfsm.ParseTypedCiscoIosShowInterfacesTransceiver(cmdResults["show interfaces transceiver"])
+	if err != nil {
+		return nil, fmt.Errorf("couldnt parse show interfaces transceiver result")
+	}
+
+	for _, tr := range transceivers {
+		powers := []struct {
+			direction string
+			power     string
+			flag      string
+			low       float64
+			high      float64
+		}{
+			{"tx", tr.TxPower, tr.TxFlag, Thresholds.TxPowerLow, Thresholds.TxPowerHigh},
+			{"rx", tr.RxPower, tr.RxFlag, Thresholds.RxPowerLow, Thresholds.RxPowerHigh},
+		}
+		for _, p := range powers {
+			severity := powerSeverity(p.power, p.flag, p.low, p.high)
+			if severity == Info {
+				continue
+			}
+			results = append(results, CheckResult{
+				CheckName: checkName,
+				Device:    router,
+				Result:    fmt.Sprintf("%s: %s power %s dBm, alarm flag %q, limits %.1f..%.1f dBm", tr.Port, strings.ToUpper(p.direction), p.power, p.flag, p.low, p.high),
+				Severity:  severity,
+				Fields:    map[string]string{"interface": tr.Port, "direction": p.direction, "power": p.power, "flag": p.flag},
+			})
+		}
+	}
+
+	return results, nil
+}
+
+func CheckLicenses(router string, cmdResults map[string]string) ([]CheckResult, error) {
+	var results []CheckResult
+
+	checkName := "CheckLicenses"
+
+	if _, ok := cmdResults["show license all"]; !ok {
+		return []CheckResult{{checkName, router, "failed to get 'show license all' command output", Critical, nil}}, nil
+	}
+
+	licenses, err := textfsm.ParseTypedCiscoIosShowLicenseAll(cmdResults["show license all"])
+	if err != nil {
+		return nil, fmt.Errorf("couldnt parse show license all result")
+	}
+
+	for _, license := range licenses {
+		// Classic licenses have a type and a state, smart licenses have a status.
+		state := strings.ToLower(license.Type + " " + license.State + " " + license.Status)
+		fields := map[string]string{"feature": license.Feature, "type": license.Type, "state": license.State, "status": license.Status}
+		inUse := strings.Contains(state, "in use") && !strings.Contains(state, "not in use")
+
+		switch {
+		case strings.Contains(state, "expired"):
+			results = append(results, CheckResult{checkName, router, fmt.Sprintf("%s: license expired", license.Feature), Critical, fields})
+		case strings.Contains(state, "out of compliance") || strings.Contains(state, "not authorized"):
+			results = append(results, CheckResult{checkName, router, fmt.Sprintf("%s: license %s", license.Feature, strings.ToLower(license.Status)), Critical, fields})
+		case strings.Contains(state, "eval") && (inUse || license.Status != ""):
+			results = append(results, CheckResult{checkName, router, fmt.Sprintf("%s: evaluation license in use, period left %q", license.Feature, license.PeriodLeft), Warning, fields})
+		case strings.Contains(state, "eval"):
+			results = append(results, CheckResult{checkName, router, fmt.Sprintf("%s: evaluation license present", license.Feature), Info, fields})
+		}
+	}
+
+	return results, nil
+}
+
+func CheckHsrp(router string, cmdResults map[string]string) ([]CheckResult, error) {
+	var results []CheckResult
+
+	checkName := "CheckHsrp"
+
+	if _, ok := cmdResults["show standby"]; !ok {
+		return []CheckResult{{checkName, router, "failed to get 'show standby' command output", Critical, nil}}, nil
+	}
+
+	groups, err := textfsm.ParseTypedCiscoIosShowStandby(cmdResults["show standby"])
+	if err != nil {
+		return nil, fmt.Errorf("couldnt parse show standby result")
+	}
+
+	for _, group := range groups {
+		fields := map[string]string{"interface": group.Interface, "group": group.Group, "state": group.State, "active_router": group.ActiveRouter}
+
+		if group.State == "Init" {
+			results = append(results, CheckResult{checkName, router, fmt.Sprintf("%s group %s: state Init", group.Interface, group.Group), Critical, fields})
+			continue
+		}
+
+		// With preemption, the router with the highest priority should be active.
+		priority, err1 := strconv.Atoi(group.Priority)
+		activePriority, err2 := strconv.Atoi(group.ActivePriority)
+		if group.Preempt == "enabled" && group.State != "Active" && err1 == nil && err2 == nil && priority > activePriority {
+			results = append(results, CheckResult{
+				CheckName: checkName,
+				Device:    router,
+				Result:    fmt.Sprintf("%s group %s: unexpected active router %s with priority %d, local priority is %d", group.Interface, group.Group, group.ActiveRouter, activePriority, priority),
+				Severity:  Warning,
+				Fields:    fields,
+			})
 		}
 	}
 
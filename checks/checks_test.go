@@ -1,8 +1,11 @@
 package checks
 
 import (
-	"github.com/go-test/deep"
+	"os"
+	"path/filepath"
 	"testing"
+
+	"github.com/go-test/deep"
 )
 
 func TestCheckInterfaces(t *testing.T) {
@@ -40,7 +43,7 @@ Description: also good
 Description: bad because admin up line down
 `},
 			nil, // no error
-			[]CheckResult{{"CheckInterfaces", dev, "GigabitEthernet0/1: admin \"up\" protocol \"down\""}},
+			[]CheckResult{{"CheckInterfaces", dev, "GigabitEthernet0/1: admin \"up\" protocol \"down\"", Critical, map[string]string{"interface": "GigabitEthernet0/1", "link_status": "up", "protocol_status": "down"}}},
 		},
 		{
 			"wrong IntfStatus: Input errors",
@@ -50,7 +53,7 @@ Description: bad because input errors
       33 input errors, 0 CRC, 0 frame, 0 overrun, 0 ignored, 0 abort
 `},
 			nil, // no error
-			[]CheckResult{{"CheckInterfaces", dev, "GigabitEthernet0/1: 33 input errors"}},
+			[]CheckResult{{"CheckInterfaces", dev, "GigabitEthernet0/1: 33 input errors", Warning, map[string]string{"interface": "GigabitEthernet0/1", "counter": "input_errors", "value": "33"}}},
 		},
 		{
 			"wrong IntfStatus: CRC errors",
@@ -60,7 +63,7 @@ Description: bad because input errors
      0 input errors, 92 CRC, 0 frame, 0 overrun, 0 ignored, 0 abort
 `},
 			nil, // no error
-			[]CheckResult{{"CheckInterfaces", dev, "GigabitEthernet0/1: 92 CRC errors"}},
+			[]CheckResult{{"CheckInterfaces", dev, "GigabitEthernet0/1: 92 CRC errors", Warning, map[string]string{"interface": "GigabitEthernet0/1", "counter": "crc", "value": "92"}}},
 		},
 	}
 
@@ -75,3 +78,228 @@ Description: bad because input errors
 		}
 	}
 }
+
+func TestParseSeverity(t *testing.T) {
+	for _, want := range []Severity{Info, Warning, Critical} {
+		got, err := ParseSeverity(want.String())
+		if err != nil {
+			t.Fatalf("ParseSeverity(%q) failed: %v", want.String(), err)
+		}
+		if got != want {
+			t.Errorf("ParseSeverity(%q): got %v want %v", want.String(), got, want)
+		}
+	}
+
+	if _, err := ParseSeverity("fatal"); err == nil {
+		t.Errorf("ParseSeverity(%q) should fail", "fatal")
+	}
+}
+
+func TestStatus(t *testing.T) {
+	dev := "router1"
+
+	tests := []struct {
+		Comment string
+		Results []CheckResult
+		Want    CheckStatus
+	}{
+		{
+			"no results",
+			nil,
+			CheckStatus{"Interfaces", dev, true, Info},
+		},
+		{
+			"only informational",
+			[]CheckResult{{Severity: Info}},
+			CheckStatus{"Interfaces", dev, true, Info},
+		},
+		{
+			"worst severity counts",
+			[]CheckResult{{Severity: Warning}, {Severity: Critical}, {Severity: Info}},
+			CheckStatus{"Interfaces", dev, false, Critical},
+		},
+	}
+
+	for _, test := range tests {
+		got := Status("Interfaces", dev, test.Results)
+		if diff := deep.Equal(got, test.Want); diff != nil {
+			t.Errorf("test %q: %v", test.Comment, diff)
+		}
+	}
+}
+
+func TestFilter(t *testing.T) {
+	results := []CheckResult{{Result: "a", Severity: Info}, {Result: "b", Severity: Warning}, {Result: "c", Severity: Critical}}
+
+	got := Filter(results, Warning)
+	want := []CheckResult{{Result: "b", Severity: Warning}, {Result: "c", Severity: Critical}}
+	if diff := deep.Equal(got, want); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func readTestdata(t *testing.T, fn string) string {
+	bts, err := os.ReadFile(filepath.Join("../textfsm/testdata", fn))
+	if err != nil {
+		t.Fatalf("failed to read test data %q: %v", fn, err)
+	}
+	return string(bts)
+}
+
+func TestDeviceChecks(t *testing.T) {
+	dev := "router1"
+
+	tests := []struct {
+		Comment    string
+		F          func(router string, cmdResults map[string]string) ([]CheckResult, error)
+		CmdResults map[string]string
+		Want       []string
+	}{
+		{
+			"config register will change at next reload",
+			CheckBootvar,
+			map[string]string{"show bootvar": readTestdata(t, "cisco_ios_show_bootvar")},
+			[]string{"warning configuration register will be 0x2142 at next reload, expected 0x2102"},
+		},
+		{
+			"all BFD sessions up",
+			CheckBfd,
+			map[string]string{"show bfd neighbors": readTestdata(t, "cisco_ios_show_bfd_neighbor")},
+			nil,
+		},
+		{
+			"BFD session down",
+			CheckBfd,
+			map[string]string{"show bfd neighbors": `IPv4 Sessions
+NeighAddr                              LD/RD         RH/RS     State     Int
+10.1.134.2                              1/0          Down      Down      Gi0/0/0
+`},
+			[]string{`critical 10.1.134.2 on Gi0/0/0: state "Down" remote state "Down"`},
+		},
+		{
+			"transceiver alarms",
+			CheckTransceivers,
+			map[string]string{"show interfaces transceiver": readTestdata(t, "cisco_ios_show_interfaces_transceiver")},
+			[]string{
+				`warning Te1/1/2: RX power -17.9 dBm, alarm flag "-", limits -20.0..5.0 dBm`,
+				`critical Te1/1/3: RX power -40.0 dBm, alarm flag "--", limits -20.0..5.0 dBm`,
+				`critical Te1/1/4: TX power -12.0 dBm, alarm flag "--", limits -10.0..5.0 dBm`,
+			},
+		},
+		{
+			"classic evaluation and expired licenses",
+			CheckLicenses,
+			map[string]string{"show license all": readTestdata(t, "cisco_ios_show_license_all")},
+			[]string{
+				`warning securityk9: evaluation license in use, period left "2  weeks 3  days"`,
+				`critical uck9: license expired`,
+			},
+		},
+		{
+			"smart license expired evaluation",
+			CheckLicenses,
+			map[string]string{"show license all": readTestdata(t, "cisco_ios_show_license_all_smart")},
+			[]string{`critical dna-advantage: license expired`},
+		},
+		{
+			"HSRP init and unexpected active router",
+			CheckHsrp,
+			map[string]string{"show standby": readTestdata(t, "cisco_ios_show_standby")},
+			[]string{
+				`warning Vlan20 group 20: unexpected active router 10.20.20.3 with priority 100, local priority is 120`,
+				`critical Vlan30 group 30: state Init`,
+			},
+		},
+		{
+			"missing output",
+			CheckHsrp,
+			map[string]string{},
+			[]string{`critical failed to get 'show standby' command output`},
+		},
+	}
+
+	for _, test := range tests {
+		results, err := test.F(dev, test.CmdResults)
+		if err != nil {
+			t.Fatalf("test %q: unexpected error %v", test.Comment, err)
+		}
+
+		var got []string
+		for _, r := range results {
+			got = append(got, r.Severity.String()+" "+r.Result)
+		}
+		if diff := deep.Equal(got, test.Want); diff != nil {
+			t.Errorf("test %q: %v", test.Comment, diff)
+		}
+	}
+}
+
+func TestCheckBgpSumPolicy(t *testing.T) {
+	policy, err := LoadPolicy("testdata/policy.yaml")
+	if err != nil {
+		t.Fatalf("failed to load policy: %v", err)
+	}
+	defer func(old Policy) { CurrentPolicy = old }(CurrentPolicy)
+	CurrentPolicy = policy
+
+	tests := []struct {
+		Comment string
+		Device  string
+		Output  string
+		Want    []string
+	}{
+		{
+			"device without policy, all established",
+			"router2",
+			readTestdata(t, "cisco_ios_show_bgp_summary"),
+			nil,
+		},
+		{
+			"device with policy",
+			"router1",
+			`BGP router identifier 192.0.2.70, local AS number 65550
+
+Neighbor        V    AS MsgRcvd MsgSent   TblVer  InQ OutQ Up/Down  State/PfxRcd
+192.0.2.77      4 65551    6965    1766        9    0    0  00:10:00        1
+192.0.2.78      4 65552    6965    1766        9    0    0  never    Idle
+192.0.2.80      4 65554    6965    1766        9    0    0  5w4d     Active
+`,
+			[]string{
+				"warning 192.0.2.77: flapping, established for only 00:10:00",
+				"warning 192.0.2.77: received 1 prefixes, expected at least 5",
+				"info 192.0.2.78: idle status \"Idle\"",
+				"critical 192.0.2.80: idle status \"Active\"",
+				"critical 192.0.2.79: expected neighbor missing",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		results, err := CheckBgpSum(test.Device, map[string]string{"show bgp sum": test.Output})
+		if err != nil {
+			t.Fatalf("test %q: unexpected error %v", test.Comment, err)
+		}
+
+		var got []string
+		for _, r := range results {
+			got = append(got, r.Severity.String()+" "+r.Result)
+		}
+		if diff := deep.Equal(got, test.Want); diff != nil {
+			t.Errorf("test %q: %v", test.Comment, diff)
+		}
+	}
+}
+
+func TestCheckInterfacesAllowedDown(t *testing.T) {
+	defer func(old Policy) { CurrentPolicy = old }(CurrentPolicy)
+	CurrentPolicy = Policy{Devices: map[string]DevicePolicy{"router1": {InterfacesAllowedDown: []string{"GigabitEthernet0/3"}}}}
+
+	got, err := CheckInterfaces("router1", map[string]string{"show interfaces": `GigabitEthernet0/3 is down, line protocol is down
+`})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(got) != 1 || got[0].Severity != Info {
+		t.Errorf("expected a single informational result for an interface allowed down, got %v", got)
+	}
+}
@@ -0,0 +1,133 @@
+package checks
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// NeighborPolicy is the expected state of a single BGP neighbor.
+type NeighborPolicy struct {
+	// MinPrefixes is the minimum number of prefixes that should be received from the neighbor.
+	MinPrefixes int `yaml:"min_prefixes"`
+	// AllowedDown is true for neighbors that don't need to be established.
+	AllowedDown bool `yaml:"allowed_down"`
+}
+
+// DevicePolicy is the expected state of a single device.
+type DevicePolicy struct {
+	// BgpNeighbors are the neighbors that are expected on the device, by remote address.
+	BgpNeighbors map[string]NeighborPolicy `yaml:"bgp_neighbors"`
+	// InterfacesAllowedDown are interfaces that are allowed to be down, even though they're not shut down.
+	InterfacesAllowedDown []string `yaml:"interfaces_allowed_down"`
+}
+
+// Policy describes the intended state of devices, so the checks can tell what's broken from what's expected.
+//
+// An example policy file:
+//
+//	min_bgp_uptime: 1h
+//	devices:
+//	  rtr1:
+//	    bgp_neighbors:
+//	      192.0.2.77:
+//	        min_prefixes: 100
+//	      192.0.2.78:
+//	        allowed_down: true
+//	    interfaces_allowed_down:
+//	      - GigabitEthernet0/3
+type Policy struct {
+	// MinBgpUptime is how long a BGP session needs to be established. Sessions that are up shorter are flapping.
+	MinBgpUptime time.Duration           `yaml:"min_bgp_uptime"`
+	Devices      map[string]DevicePolicy `yaml:"devices"`
+}
+
+// DefaultPolicy is the policy used when there's no policy file.
+var DefaultPolicy = Policy{
+	MinBgpUptime: time.Hour,
+}
+
+// CurrentPolicy is the policy the checks compare against.
+var CurrentPolicy = DefaultPolicy
+
+// LoadPolicy reads a policy file. Settings that aren't in the file keep their default value.
+func LoadPolicy(fn string) (Policy, error) {
+	policy := DefaultPolicy
+
+	bts, err := os.ReadFile(fn)
+	if err != nil {
+		return policy, fmt.Errorf("failed to read policy file %q: %w", fn, err)
+	}
+	if err := yaml.Unmarshal(bts, &policy); err != nil {
+		return policy, fmt.Errorf("could not parse policy file %q: %w", fn, err)
+	}
+	return policy, nil
+}
+
+// Device returns the policy for a device. Devices not in the policy have an empty policy.
+func (p Policy) Device(device string) DevicePolicy {
+	return p.Devices[device]
+}
+
+// InterfaceAllowedDown returns true if the interface is allowed to be down.
+func (dp DevicePolicy) InterfaceAllowedDown(intf string) bool {
+	for _, i := range dp.InterfacesAllowedDown {
+		if i == intf {
+			return true
+		}
+	}
+	return false
+}
+
+var uptimeUnits = map[byte]time.Duration{
+	'y': 365 * 24 * time.Hour,
+	'w': 7 * 24 * time.Hour,
+	'd': 24 * time.Hour,
+	'h': time.Hour,
+	'm': time.Minute,
+	's': time.Second,
+}
+
+// ParseUptime parses the Up/Down column of "show bgp summary", for example "00:01:02", "1d02h", or "5w4d".
+func ParseUptime(s string) (time.Duration, error) {
+	if strings.Contains(s, ":") {
+		parts := strings.Split(s, ":")
+		if len(parts) != 3 {
+			return 0, fmt.Errorf("invalid uptime %q", s)
+		}
+		var result time.Duration
+		for i, unit := range []time.Duration{time.Hour, time.Minute, time.Second} {
+			n, err := strconv.Atoi(parts[i])
+			if err != nil {
+				return 0, fmt.Errorf("invalid uptime %q: %v", s, err)
+			}
+			result += time.Duration(n) * unit
+		}
+		return result, nil
+	}
+
+	var result time.Duration
+	number := ""
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c >= '0' && c <= '9' {
+			number += string(c)
+			continue
+		}
+		unit, ok := uptimeUnits[c]
+		if !ok || number == "" {
+			return 0, fmt.Errorf("invalid uptime %q", s)
+		}
+		n, _ := strconv.Atoi(number)
+		result += time.Duration(n) * unit
+		number = ""
+	}
+	if number != "" || s == "" {
+		return 0, fmt.Errorf("invalid uptime %q", s)
+	}
+	return result, nil
+}
@@ -0,0 +1,59 @@
+package checks
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+)
+
+func TestParseUptime(t *testing.T) {
+	tests := []struct {
+		Input   string
+		Want    time.Duration
+		WantErr bool
+	}{
+		{"00:01:02", time.Minute + 2*time.Second, false},
+		{"1d02h", 26 * time.Hour, false},
+		{"5w4d", 39 * 24 * time.Hour, false},
+		{"1y2w", (365 + 14) * 24 * time.Hour, false},
+		{"never", 0, true},
+		{"12", 0, true},
+		{"", 0, true},
+	}
+
+	for _, test := range tests {
+		got, err := ParseUptime(test.Input)
+		if (err != nil) != test.WantErr {
+			t.Errorf("ParseUptime(%q): got error %v, want error %v", test.Input, err, test.WantErr)
+			continue
+		}
+		if got != test.Want {
+			t.Errorf("ParseUptime(%q): got %v want %v", test.Input, got, test.Want)
+		}
+	}
+}
+
+func TestLoadPolicy(t *testing.T) {
+	got, err := LoadPolicy("testdata/policy.yaml")
+	if err != nil {
+		t.Fatalf("failed to load policy: %v", err)
+	}
+
+	want := Policy{
+		MinBgpUptime: 30 * time.Minute,
+		Devices: map[string]DevicePolicy{
+			"router1": {
+				BgpNeighbors: map[string]NeighborPolicy{
+					"192.0.2.77": {MinPrefixes: 5},
+					"192.0.2.78": {AllowedDown: true},
+					"192.0.2.79": {MinPrefixes: 1},
+				},
+				InterfacesAllowedDown: []string{"GigabitEthernet0/3"},
+			},
+		},
+	}
+	if diff := deep.Equal(got, want); diff != nil {
+		t.Error(diff)
+	}
+}
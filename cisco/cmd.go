@@ -3,11 +3,16 @@ package cisco
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"strings"
 	"time"
 
+	"github.com/cdevr/cpush/credentials"
+	"github.com/cdevr/cpush/jump"
 	"github.com/cdevr/cpush/options"
+	"github.com/cdevr/cpush/transcript"
 	"github.com/cdevr/cpush/utils"
 	"golang.org/x/crypto/ssh"
 )
@@ -23,6 +28,9 @@ const quitTclSh = "exit"
 const commitConfig = "copy flash:configlet running-config"
 const confirm = "y"
 
+// copyTimeLimit is how long copying a configlet to the running config can take.
+const copyTimeLimit = 10 * time.Second
+
 func isRN(r rune) bool {
 	return r == '\r' || r == '\n'
 }
@@ -55,40 +63,142 @@ func respondInteractive(password string) func(user, instruction string, question
 	}
 }
 
-// Push pushes a configlet to an ios device.
-func Push(opts *options.Options, device string, username string, password string, configlet string, timeout time.Duration) (string, error) {
+// Client is an SSH connection to a device, that is closed as soon as its context is done. Closing the connection
+// aborts anything that is still running on it.
+type Client struct {
+	*ssh.Client
+	stop chan struct{}
+}
+
+func (c *Client) Close() error {
+	close(c.stop)
+	return c.Client.Close()
+}
+
+// Dial opens an SSH connection to a device. Without a password, the credentials of the device are requested from the
+// options, and tried in order until the device accepts one, see credentials.Login. The device is looked up in the ssh
+// config of the options for the address to connect to, the username if none is given, identity files and jump hosts.
+func Dial(ctx context.Context, opts *options.Options, device string, username string, password string) (*Client, error) {
+	if password != "" || opts.Credentials == nil {
+		return dialAs(ctx, opts, device, username, password)
+	}
+	var client *Client
+	err := credentials.Login(ctx, opts.Credentials, device, func(c credentials.Credential) error {
+		u := username
+		if c.Username != "" {
+			u = c.Username
+		}
+		var err error
+		client, err = dialAs(ctx, opts, device, u, c.Password)
+		return err
+	})
+	return client, err
+}
+
+// dialAs opens an SSH connection to a device with a username and password. If the device refuses them, the error
+// wraps credentials.ErrAuthFailed.
+func dialAs(ctx context.Context, opts *options.Options, device string, username string, password string) (*Client, error) {
+	host := opts.SSHConfig.Lookup(device)
+	if username == "" {
+		username = host.User
+	}
 	config := &ssh.ClientConfig{
 		User: username,
-		Auth: []ssh.AuthMethod{
+		Auth: append(host.PublicKeys(),
 			ssh.Password(password),
 			ssh.KeyboardInteractive(respondInteractive(password)),
-		},
+		),
 		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
 		Config:          sshConfig(),
 	}
 
-	addr := device
-	if !strings.Contains(addr, ":") {
-		addr = addr + ":22"
+	addr := host.Address()
+	dialFunc := opts.Dial
+	if host.ProxyJump != "" {
+		var err error
+		dialFunc, err = jump.Via(opts.SSHConfig.ProxyJump(host.ProxyJump, username), username, password, opts.Dialer)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ProxyJump for device %q: %v", device, err)
+		}
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), opts.Timeout)
+	// The dialer is told the device, since the ssh config might have changed the address.
+	dialCtx, cancel := context.WithTimeout(options.WithDevice(ctx, device), opts.Timeout)
 	defer cancel()
 
-	tcpConn, err := opts.Dial(ctx, "tcp", addr)
+	tcpConn, err := dialFunc(dialCtx, "tcp", addr)
 	if err != nil {
-		return "", fmt.Errorf("failed to connect to device %q as user %q: %v", device, username, err)
+		return nil, fmt.Errorf("failed to connect to device %q as user %q: %v", device, username, err)
 	}
+
+	// Close the TCP connection when the context is done, that interrupts the handshake and any running session.
+	stop := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			tcpConn.Close()
+		case <-stop:
+		}
+	}()
+
 	sshConn, chans, reqs, err := ssh.NewClientConn(tcpConn, addr, config)
 	if err != nil {
-		return "", fmt.Errorf("failed to connect to device %q as user %q: %v", device, username, err)
+		close(stop)
+		tcpConn.Close()
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("failed to connect to device %q as user %q: %v", device, username, ctx.Err())
+		}
+		return nil, fmt.Errorf("failed to connect to device %q as user %q: %w", device, username, credentials.CheckAuth(err))
+	}
+	return &Client{ssh.NewClient(sshConn, chans, reqs), stop}, nil
+}
+
+// AppliedError is returned by Push when the push failed after the configlet was copied to the running config, so the
+// device might have some or all of it. The push must not be tried again, see Retryable.
+type AppliedError struct {
+	Device string
+	Err    error
+}
+
+func (e *AppliedError) Error() string {
+	return fmt.Sprintf("configlet was applied on %q, but the push failed: %v", e.Device, e.Err)
+}
+
+func (e *AppliedError) Unwrap() error {
+	return e.Err
+}
+
+// Push pushes a configlet to an ios device. When it fails after the configlet was applied, the error is an
+// *AppliedError, or a *ConfigletError if the device rejected lines of it.
+func Push(ctx context.Context, opts *options.Options, device string, username string, password string, configlet string, timeout time.Duration) (string, error) {
+	output, applied, err := push(ctx, opts, device, username, password, configlet, timeout, nil, true)
+	var ce *ConfigletError
+	if err != nil && applied && !errors.As(err, &ce) {
+		return output, &AppliedError{device, err}
+	}
+	return output, err
+}
+
+// prepareFunc runs commands in the shell of a push before the configlet is applied, for example to back up the
+// running config. An error aborts the push.
+type prepareFunc func(ctx context.Context, stdin io.Writer, output *utils.ThreadSafeBuffer) error
+
+// push pushes a configlet to an ios device. If prepare is not nil, it's called before the configlet is applied. The
+// configuration is only written to the startup config if write is true. applied is true when the configlet was
+// copied to the running config, whether that succeeded or not.
+func push(ctx context.Context, opts *options.Options, device string, username string, password string, configlet string, timeout time.Duration, prepare prepareFunc, write bool) (output string, applied bool, err error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	conn, err := Dial(ctx, opts, device, username, password)
+	if err != nil {
+		return "", false, err
 	}
-	conn := ssh.NewClient(sshConn, chans, reqs)
 	defer conn.Close()
 
 	session, err := conn.NewSession()
 	if err != nil {
-		return "", fmt.Errorf("failed to get session on device %q: %v", device, err)
+		return "", false, fmt.Errorf("failed to get session on device %q: %v", device, err)
 	}
 	defer session.Close()
 
@@ -97,93 +207,113 @@ func Push(opts *options.Options, device string, username string, password string
 	}
 
 	if err := session.RequestPty("xterm", 50, 80, modes); err != nil {
-		return "", fmt.Errorf("failed to get pty on device %q: %v", device, err)
+		return "", false, fmt.Errorf("failed to get pty on device %q: %v", device, err)
 	}
 
-	stdinBuf, err := session.StdinPipe()
+	stdinPipe, err := session.StdinPipe()
 	if err != nil {
-		return "", fmt.Errorf("failed to get stdin connected to remote host %q: %v", device, err)
+		return "", false, fmt.Errorf("failed to get stdin connected to remote host %q: %v", device, err)
 	}
 
-	if err := session.Shell(); err != nil {
-		return "", fmt.Errorf("failed to get shell on device %q: %v", device, err)
+	rec, err := transcript.Create(opts.LogDir, transcript.Header{
+		Device:          device,
+		Operator:        opts.Operator,
+		Operation:       "push",
+		ConfigletSHA256: transcript.Hash(configlet),
+	})
+	if err != nil {
+		return "", false, err
 	}
+	defer rec.Close()
+	stdinBuf := rec.Input(stdinPipe)
 
-	var output utils.ThreadSafeBuffer
-	session.Stdout = &output
+	var out utils.ThreadSafeBuffer
+	session.Stdout = rec.Output(&out)
 
-	utils.WaitForPrompt(&output, 2*time.Second, opts.SuppressBanner)
+	if err := session.Shell(); err != nil {
+		return "", false, fmt.Errorf("failed to get shell on device %q: %v", device, err)
+	}
+
+	utils.WaitForPrompt(&out, 2*time.Second, opts.SuppressBanner)
 
 	if _, err := stdinBuf.Write([]byte(noMore + "\r\n")); err != nil {
-		return "", fmt.Errorf("failed to run command %q on device %q: %v", noMore, device, err)
+		return "", false, fmt.Errorf("failed to run command %q on device %q: %v", noMore, device, err)
 	}
-	utils.WaitForPrompt(&output, 2*time.Second, false)
+	utils.WaitForPrompt(&out, 2*time.Second, false)
 	if opts.SuppressSending {
-		output.DiscardUntil('\r')
+		out.DiscardUntil('\r')
+	}
+
+	if prepare != nil {
+		if err := prepare(ctx, stdinBuf, &out); err != nil {
+			return out.String(), false, err
+		}
 	}
 
 	if _, err := stdinBuf.Write([]byte(startTclSh + "\r\n")); err != nil {
-		return "", fmt.Errorf("failed to run command %q on device %q: %v", startTclSh, device, err)
+		return "", false, fmt.Errorf("failed to run command %q on device %q: %v", startTclSh, device, err)
 	}
 	time.Sleep(200 * time.Millisecond)
 	if _, err := stdinBuf.Write([]byte(configTemplateOpen + "\r")); err != nil {
-		return "", fmt.Errorf("failed to run command %q on device %q: %v", configTemplateOpen, device, err)
+		return "", false, fmt.Errorf("failed to run command %q on device %q: %v", configTemplateOpen, device, err)
 	}
 	time.Sleep(200 * time.Millisecond)
-	// Expand ";" to \n to allow for multiline.
-	expandedConfiglet := strings.ReplaceAll(configlet, ";", "\n")
-	for _, s := range strings.Split(expandedConfiglet, "\n") {
+	for _, s := range configletLines(configlet) {
 		if _, err := stdinBuf.Write([]byte(s + "\r")); err != nil {
-			return "", fmt.Errorf("failed to enter configlet line %q on device %q: %v", s, device, err)
+			return "", false, fmt.Errorf("failed to enter configlet line %q on device %q: %v", s, device, err)
 		}
 		time.Sleep(20)
 	}
 	if _, err := stdinBuf.Write([]byte(configTemplateClose + "\r")); err != nil {
-		return "", fmt.Errorf("failed to run command %q on device %q: %v", configTemplateClose, device, err)
+		return "", false, fmt.Errorf("failed to run command %q on device %q: %v", configTemplateClose, device, err)
 	}
 	time.Sleep(100 * time.Millisecond)
 	if _, err := stdinBuf.Write([]byte(quitTclSh + "\r")); err != nil {
-		return "", fmt.Errorf("failed to run command %q on device %q: %v", quitTclSh, device, err)
+		return "", false, fmt.Errorf("failed to run command %q on device %q: %v", quitTclSh, device, err)
 	}
 	time.Sleep(100 * time.Millisecond)
+	copyStart := out.Len()
 	if _, err := stdinBuf.Write([]byte(commitConfig + "\r")); err != nil {
-		return "", fmt.Errorf("failed to run command %q on device %q: %v", commitConfig, device, err)
+		return "", false, fmt.Errorf("failed to run command %q on device %q: %v", commitConfig, device, err)
 	}
+	applied = true
 	time.Sleep(100 * time.Millisecond)
-	utils.WaitFor(&output, "?", 5*time.Second)
-	if strings.Contains(output.LastLine(), "Destination filename") {
+	utils.WaitFor(&out, "?", 5*time.Second)
+	if strings.Contains(out.LastLine(), "Destination filename") {
 		if _, err := stdinBuf.Write([]byte("\r")); err != nil {
-			return "", fmt.Errorf("failed to confirm write on device %q: %v", device, err)
+			return "", applied, fmt.Errorf("failed to confirm write on device %q: %v", device, err)
 		}
 	} else {
 		if _, err := stdinBuf.Write([]byte(confirm + "\r")); err != nil {
-			return "", fmt.Errorf("failed to run command %q on device %q: %v", confirm, device, err)
+			return "", applied, fmt.Errorf("failed to run command %q on device %q: %v", confirm, device, err)
 		}
 	}
-	time.Sleep(200 * time.Millisecond)
-	if _, err := stdinBuf.Write([]byte(wrCommand + "\r")); err != nil {
-		return "", fmt.Errorf("failed to run command %q on device %q: %v", wrCommand, device, err)
+	// The copy ends with how many bytes were copied, errors about configlet lines are printed before that.
+	utils.WaitFor(&out, "bytes copied", copyTimeLimit)
+	copyOutput := out.String()[copyStart:]
+	if write {
+		if _, err := stdinBuf.Write([]byte(wrCommand + "\r")); err != nil {
+			return "", applied, fmt.Errorf("failed to run command %q on device %q: %v", wrCommand, device, err)
+		}
 	}
 	time.Sleep(200 * time.Millisecond)
 	if _, err := stdinBuf.Write([]byte(exitCommand + "\r")); err != nil {
-		return "", fmt.Errorf("failed to run command %q on device %q: %v", exitCommand, device, err)
+		return "", applied, fmt.Errorf("failed to run command %q on device %q: %v", exitCommand, device, err)
 	}
 	time.Sleep(200 * time.Millisecond)
 
-	utils.WaitForPrompt(&output, 2*time.Second, false)
+	utils.WaitForPrompt(&out, 2*time.Second, false)
 
-	if strings.Contains(output.String(), "Invalid input") {
-		var errorLines []string
-		for _, line := range strings.Split(output.String(), "\n") {
-			if strings.Contains(line, "Invalid input") {
-				errorLines = append(errorLines, line)
-			}
-		}
+	output = out.String()
+	if ctx.Err() != nil {
+		return output, applied, fmt.Errorf("pushing configlet to %q aborted: %v", device, ctx.Err())
+	}
 
-		return output.String(), fmt.Errorf("error in configlet: %s\n%s", strings.Join(errorLines, "\n"), output.String())
+	if rejected := parseCopyOutput(configlet, copyOutput); len(rejected) > 0 {
+		return output, applied, &ConfigletError{device, rejected}
 	}
 
-	return output.String(), nil
+	return output, applied, nil
 }
 
 // sshConfig returns additional ssh configuration options for cisco routers, such as allowing bad ciphers used by Cisco.
@@ -199,59 +329,27 @@ func sshConfig() ssh.Config {
 }
 
 // Cmd executes a command on a device and returns the output.
-func Cmd(opts *options.Options, device string, username string, password string, cmd string, timeout time.Duration) (string, error) {
-	// Sets the time when the timeout has elapsed.
-	var whenToQuit = time.Now().Add(timeout)
-
-	var result bytes.Buffer
-
-	config := &ssh.ClientConfig{
-		User: username,
-		Auth: []ssh.AuthMethod{
-			ssh.Password(password),
-			ssh.KeyboardInteractive(respondInteractive(password)),
-		},
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
-		Config:          sshConfig(),
-	}
-
-	addr := device
-	if !strings.Contains(addr, ":") {
-		addr = addr + ":22"
-	}
-
-	ctx, cancel := context.WithTimeout(context.Background(), opts.Timeout)
+func Cmd(ctx context.Context, opts *options.Options, device string, username string, password string, cmd string, timeout time.Duration) (string, error) {
+	// The connection is closed when the timeout has elapsed.
+	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
-	tcpConn, err := opts.Dial(ctx, "tcp", addr)
-	if err != nil {
-		return "", fmt.Errorf("failed to connect to device %q as user %q: %v", device, username, err)
-	}
-	defer tcpConn.Close()
-
-	if time.Now().After(whenToQuit) {
-		return "", fmt.Errorf("timeout executing command on %q: %v elapsed", device, timeout)
-	}
+	var result bytes.Buffer
 
-	sshConn, chans, reqs, err := ssh.NewClientConn(tcpConn, addr, config)
+	conn, err := Dial(ctx, opts, device, username, password)
 	if err != nil {
-		return "", fmt.Errorf("failed to connect to device %q as user %q: %v", device, username, err)
+		return "", err
 	}
-	conn := ssh.NewClient(sshConn, chans, reqs)
 	defer conn.Close()
 
-	if time.Now().After(whenToQuit) {
-		return "", fmt.Errorf("timeout executing command on %q: %v elapsed", device, timeout)
-	}
-
 	session, err := conn.NewSession()
 	if err != nil {
 		return "", fmt.Errorf("failed to get session on device %q: %v", device, err)
 	}
 	defer session.Close()
 
-	if time.Now().After(whenToQuit) {
-		return "", fmt.Errorf("timeout executing command on %q: %v elapsed", device, timeout)
+	if ctx.Err() != nil {
+		return "", fmt.Errorf("timeout executing command on %q: %v", device, ctx.Err())
 	}
 
 	modes := ssh.TerminalModes{
@@ -262,26 +360,38 @@ func Cmd(opts *options.Options, device string, username string, password string,
 		return "", fmt.Errorf("failed to get pty on device %q: %v", device, err)
 	}
 
-	if time.Now().After(whenToQuit) {
-		return "", fmt.Errorf("timeout executing command on %q: %v elapsed", device, timeout)
+	if ctx.Err() != nil {
+		return "", fmt.Errorf("timeout executing command on %q: %v", device, ctx.Err())
 	}
 
-	stdinBuf, err := session.StdinPipe()
+	stdinPipe, err := session.StdinPipe()
 	if err != nil {
 		return "", fmt.Errorf("failed to get stdin connected to remote host %q: %v", device, err)
 	}
 
-	if err := session.Shell(); err != nil {
-		return "", fmt.Errorf("failed to get shell on device %q: %v", device, err)
+	rec, err := transcript.Create(opts.LogDir, transcript.Header{
+		Device:    device,
+		Operator:  opts.Operator,
+		Operation: "cmd",
+		Command:   cmd,
+	})
+	if err != nil {
+		return "", err
 	}
+	defer rec.Close()
+	stdinBuf := rec.Input(stdinPipe)
 
 	var output utils.ThreadSafeBuffer
-	session.Stdout = &output
+	session.Stdout = rec.Output(&output)
+
+	if err := session.Shell(); err != nil {
+		return "", fmt.Errorf("failed to get shell on device %q: %v", device, err)
+	}
 
 	utils.WaitForPrompt(&output, 2*time.Second, opts.SuppressBanner)
 
-	if time.Now().After(whenToQuit) {
-		return "", fmt.Errorf("timeout executing command on %q: %v elapsed", device, timeout)
+	if ctx.Err() != nil {
+		return "", fmt.Errorf("timeout executing command on %q: %v", device, ctx.Err())
 	}
 
 	if !opts.SuppressSending {
@@ -295,8 +405,8 @@ func Cmd(opts *options.Options, device string, username string, password string,
 		output.Reset()
 	}
 
-	if time.Now().After(whenToQuit) {
-		return "", fmt.Errorf("timeout executing command on %q: %v elapsed", device, timeout)
+	if ctx.Err() != nil {
+		return "", fmt.Errorf("timeout executing command on %q: %v", device, ctx.Err())
 	}
 
 	if !opts.SuppressSending {
@@ -314,8 +424,8 @@ func Cmd(opts *options.Options, device string, username string, password string,
 	}
 	time.Sleep(200 * time.Millisecond)
 
-	if time.Now().After(whenToQuit) {
-		return "", fmt.Errorf("timeout executing command on %q: %v elapsed", device, timeout)
+	if ctx.Err() != nil {
+		return "", fmt.Errorf("timeout executing command on %q: %v", device, ctx.Err())
 	}
 
 	if !opts.SuppressSending {
@@ -333,12 +443,11 @@ func Cmd(opts *options.Options, device string, username string, password string,
 		close(done)
 	}()
 
-	remainingTime := time.Until(whenToQuit)
 	select {
 	case <-done:
 		// Done!
-	case <-time.After(remainingTime):
-		return "", fmt.Errorf("timeout (%v) hit", opts.Timeout)
+	case <-ctx.Done():
+		return "", fmt.Errorf("timeout (%v) hit: %v", timeout, ctx.Err())
 	}
 	return RemovePromptSuffix(result.String()), nil
 }
@@ -1,6 +1,21 @@
 package cisco
 
-import "testing"
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/cdevr/cpush/credentials"
+	"github.com/cdevr/cpush/options"
+
+	"golang.org/x/crypto/ssh"
+)
 
 func TestRemovePromptSuffix(t *testing.T) {
 	tests := []struct {
@@ -25,3 +40,148 @@ func TestRemovePromptSuffix(t *testing.T) {
 		}
 	}
 }
+
+func TestCmdCancelClosesConnection(t *testing.T) {
+	// A server that accepts connections, but never answers the SSH handshake.
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer listener.Close()
+
+	closed := make(chan struct{})
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		// Read until the client closes the connection.
+		io.Copy(io.Discard, conn)
+		close(closed)
+	}()
+
+	opts := options.NewOptions()
+	opts.Dialer = (&net.Dialer{}).DialContext
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	start := time.Now()
+	_, err = Cmd(ctx, opts, listener.Addr().String(), "user", "password", "show version", time.Minute)
+	if err == nil {
+		t.Fatalf("expected an error from a cancelled command")
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Errorf("cancelled command took %v to return", time.Since(start))
+	}
+
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Errorf("connection to the device was not closed after cancellation")
+	}
+}
+
+// credentialMap is a credential provider for tests.
+type credentialMap map[string]credentials.Credential
+
+func (m credentialMap) Get(ctx context.Context, name string) (credentials.Credential, error) {
+	c, ok := m[name]
+	if !ok {
+		return credentials.Credential{}, credentials.ErrNotFound
+	}
+	return c, nil
+}
+
+// startSSHServer starts an SSH server that only accepts one username and password.
+func startSSHServer(t *testing.T, username string, password string) string {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate host key: %v", err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatalf("failed to make signer: %v", err)
+	}
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(c ssh.ConnMetadata, p []byte) (*ssh.Permissions, error) {
+			if c.User() == username && string(p) == password {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("wrong password")
+		},
+	}
+	config.AddHostKey(signer)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				sshConn, chans, reqs, err := ssh.NewServerConn(conn, config)
+				if err != nil {
+					return
+				}
+				defer sshConn.Close()
+				go ssh.DiscardRequests(reqs)
+				for ch := range chans {
+					ch.Reject(ssh.Prohibited, "no sessions")
+				}
+			}()
+		}
+	}()
+	return l.Addr().String()
+}
+
+func TestDialFallsBackOnAuthFailure(t *testing.T) {
+	addr := startSSHServer(t, "breakglass", "s3cret")
+
+	creds := &credentials.PerDevice{
+		Provider: credentialMap{
+			"default":    {Password: "tacacs-is-down"},
+			"breakglass": {Username: "breakglass", Password: "s3cret"},
+		},
+		Lookup:   func(device string) (string, string) { return "", "netops" },
+		Fallback: []string{"breakglass"},
+	}
+	opts := options.NewOptions()
+	opts.Dialer = (&net.Dialer{}).DialContext
+	opts.Credentials = creds
+
+	client, err := Dial(context.Background(), opts, addr, "", "")
+	if err != nil {
+		t.Fatalf("failed to log in with the fallback credential: %v", err)
+	}
+	client.Close()
+	if got := creds.LoggedInWith(addr); got != "breakglass" {
+		t.Errorf("logged in with %q, want breakglass", got)
+	}
+
+	// Without the fallback, the device refuses the credential, which isn't a connection failure.
+	creds.Fallback = nil
+	_, err = Dial(context.Background(), opts, addr, "", "")
+	if !errors.Is(err, credentials.ErrAuthFailed) {
+		t.Errorf("got %v, want ErrAuthFailed", err)
+	}
+
+	// A device that can't be reached didn't refuse anything.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	closedAddr := l.Addr().String()
+	l.Close()
+	_, err = Dial(context.Background(), opts, closedAddr, "", "")
+	if err == nil || errors.Is(err, credentials.ErrAuthFailed) {
+		t.Errorf("got %v, want a connection error", err)
+	}
+}
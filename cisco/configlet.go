@@ -0,0 +1,128 @@
+package cisco
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// rejections are the starts of the messages with which IOS rejects a configuration line.
+var rejections = []string{
+	"% Invalid input",
+	"% Incomplete command",
+	"% Ambiguous command",
+	"% Duplicate",
+	"% Unknown",
+}
+
+// RejectedLine is a configlet line that the device didn't accept.
+type RejectedLine struct {
+	// LineNumber is the number of the line in the configlet, starting at 1. It's 0 if the line the device complained
+	// about couldn't be found in the configlet.
+	LineNumber int
+	// Line is the text of the line.
+	Line string
+	// Message is the error from the device, for example "% Invalid input detected at '^' marker.".
+	Message string
+}
+
+// ConfigletError is returned when a device rejected lines of a configlet.
+type ConfigletError struct {
+	Device   string
+	Rejected []RejectedLine
+}
+
+func (e *ConfigletError) Error() string {
+	var lines []string
+	for _, r := range e.Rejected {
+		if r.LineNumber > 0 {
+			lines = append(lines, fmt.Sprintf("line %d %q: %s", r.LineNumber, r.Line, r.Message))
+		} else {
+			lines = append(lines, fmt.Sprintf("%q: %s", r.Line, r.Message))
+		}
+	}
+	return fmt.Sprintf("device %q rejected %d configlet lines:\n%s", e.Device, len(e.Rejected), strings.Join(lines, "\n"))
+}
+
+// Retryable returns false for the errors of pushes that must not be tried again: the device rejected the configlet,
+// the push failed after the configlet was applied, or the configlet was rolled back or is being reverted. Pushing
+// again would apply the same lines again, on top of the first push, a rollback or a pending revert.
+func Retryable(err error) bool {
+	var ce *ConfigletError
+	var ae *AppliedError
+	var rb *RolledBackError
+	var re *RevertedError
+	return !errors.As(err, &ce) && !errors.As(err, &ae) && !errors.As(err, &rb) && !errors.As(err, &re)
+}
+
+// configletLines splits a configlet into lines. A ";" also separates lines, to allow for multiline configlets on the
+// command line.
+func configletLines(configlet string) []string {
+	return strings.Split(strings.ReplaceAll(configlet, ";", "\n"), "\n")
+}
+
+// isRejection returns true if a line of output is an error about a configuration line.
+func isRejection(line string) bool {
+	for _, r := range rejections {
+		if strings.HasPrefix(line, r) {
+			return true
+		}
+	}
+	return false
+}
+
+// isMarker returns true for the line with a "^" under the position of an error.
+func isMarker(line string) bool {
+	trimmed := strings.TrimSpace(line)
+	return trimmed == "^"
+}
+
+// parseCopyOutput finds the lines that were rejected in the output of copying a configlet to the running config. IOS
+// prints a rejected line, optionally a line with a "^" marker, and then the error message.
+func parseCopyOutput(configlet string, output string) []RejectedLine {
+	lines := configletLines(configlet)
+
+	var result []RejectedLine
+	// The rejected lines are reported in order, so the search for the next one starts after the previous one.
+	next := 0
+	var previous []string
+	for _, line := range strings.FieldsFunc(output, isRN) {
+		line = strings.TrimRight(line, " ")
+		if !isRejection(strings.TrimSpace(line)) {
+			if strings.TrimSpace(line) != "" && !isMarker(line) {
+				previous = append(previous, line)
+			}
+			continue
+		}
+
+		rejected := RejectedLine{Message: strings.TrimSpace(line)}
+		if len(previous) > 0 {
+			rejected.Line = strings.TrimSpace(previous[len(previous)-1])
+		}
+		if n := findLine(lines, rejected.Line, next); n >= 0 {
+			rejected.LineNumber = n + 1
+			rejected.Line = lines[n]
+			next = n + 1
+		} else if n := findLine(lines, rejected.Line, 0); n >= 0 {
+			rejected.LineNumber = n + 1
+			rejected.Line = lines[n]
+		}
+		result = append(result, rejected)
+		previous = nil
+	}
+	return result
+}
+
+// findLine returns the index of the first line from start on that matches text, ignoring leading and trailing spaces,
+// or -1.
+func findLine(lines []string, text string, start int) int {
+	if text == "" {
+		return -1
+	}
+	for i := start; i < len(lines); i++ {
+		if strings.TrimSpace(lines[i]) == text {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,127 @@
+package cisco
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cdevr/cpush/fleet"
+	"github.com/cdevr/cpush/options"
+
+	"github.com/go-test/deep"
+)
+
+func TestParseCopyOutput(t *testing.T) {
+	configlet := "interface Loopback99\n ip addres 1.0.0.1 255.255.255.0\n description test\nrouter bgp 65000\n neighbor 10.0.0.1\n neighbor 10.0.0.1 remote-as 65001\nno ip domain-lookup; ip ssh ver 2"
+
+	output := strings.Join([]string{
+		"rtr1#copy flash:configlet running-config",
+		"Destination filename [running-config]? ",
+		" ip addres 1.0.0.1 255.255.255.0",
+		"    ^",
+		"% Invalid input detected at '^' marker.",
+		"",
+		" neighbor 10.0.0.1",
+		"% Incomplete command.",
+		"",
+		"ip ssh ver 2",
+		"% Ambiguous command:  \"ip ssh ver 2\"",
+		"",
+		"frobnicate",
+		"% Unknown command or computer name, or unable to find computer address",
+		"1234 bytes copied in 0.123 secs (10032 bytes/sec)",
+		"rtr1#",
+	}, "\r\n")
+
+	want := []RejectedLine{
+		{2, " ip addres 1.0.0.1 255.255.255.0", "% Invalid input detected at '^' marker."},
+		{5, " neighbor 10.0.0.1", "% Incomplete command."},
+		{8, " ip ssh ver 2", "% Ambiguous command:  \"ip ssh ver 2\""},
+		{0, "frobnicate", "% Unknown command or computer name, or unable to find computer address"},
+	}
+	if diff := deep.Equal(parseCopyOutput(configlet, output), want); diff != nil {
+		t.Errorf("parseCopyOutput: %v", diff)
+	}
+
+	clean := "rtr1#copy flash:configlet running-config\r\nDestination filename [running-config]? \r\n120 bytes copied in 0.1 secs\r\nrtr1#"
+	if got := parseCopyOutput(configlet, clean); len(got) != 0 {
+		t.Errorf("parseCopyOutput found rejected lines in clean output: %v", got)
+	}
+}
+
+func TestConfigletError(t *testing.T) {
+	var err error = &ConfigletError{"rtr1", []RejectedLine{{2, " ip addres 1.0.0.1", "% Invalid input detected at '^' marker."}}}
+
+	var configletErr *ConfigletError
+	if !errors.As(err, &configletErr) || configletErr.Rejected[0].LineNumber != 2 {
+		t.Errorf("expected a ConfigletError for line 2, got %v", err)
+	}
+	if want := `line 2 " ip addres 1.0.0.1": % Invalid input`; !strings.Contains(err.Error(), want) {
+		t.Errorf("got %q, want it to contain %q", err.Error(), want)
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	rejected := &ConfigletError{"rtr1", []RejectedLine{{1, "frobnicate", "% Invalid input detected at '^' marker."}}}
+	for _, test := range []struct {
+		err  error
+		want bool
+	}{
+		{fmt.Errorf("connection refused"), true},
+		{rejected, false},
+		{fmt.Errorf("push failed: %w", rejected), false},
+		{&AppliedError{"rtr1", fmt.Errorf("EOF")}, false},
+		{&RolledBackError{"flash:backup", fmt.Errorf("verification failed"), nil}, false},
+		{&RevertedError{"rtr1", ReloadTimer, true, 5, fmt.Errorf("connection refused")}, false},
+	} {
+		if got := Retryable(test.err); got != test.want {
+			t.Errorf("Retryable(%v) = %v, want %v", test.err, got, test.want)
+		}
+	}
+}
+
+func TestRejectedConfigletIsNotRetried(t *testing.T) {
+	r := fleet.NewRunner(fleet.Config{Retries: 3, Timeout: time.Second, Retryable: Retryable})
+	attempts := 0
+	summary := r.Run(context.Background(), []string{"rtr1"}, func(ctx context.Context, device string) (string, error) {
+		attempts++
+		return "", &ConfigletError{device, []RejectedLine{{1, "frobnicate", "% Invalid input detected at '^' marker."}}}
+	})
+	if attempts != 1 {
+		t.Errorf("rejected configlet was pushed %d times, want 1", attempts)
+	}
+	if len(summary.Failed) != 1 {
+		t.Errorf("got failed devices %v, want rtr1", summary.Failed)
+	}
+}
+
+func TestAppliedConfigletIsNotRetried(t *testing.T) {
+	// The session dies while the device copies the configlet to the running config.
+	device := startIOSDevice(t, map[string]string{
+		commitConfig: "Destination filename [running-config]? ",
+	}, nil, commitConfig)
+	opts := options.NewOptions()
+	opts.Dialer = (&net.Dialer{}).DialContext
+
+	r := fleet.NewRunner(fleet.Config{Retries: 3, Timeout: time.Minute, Retryable: Retryable})
+	summary := r.Run(context.Background(), []string{device.addr}, func(ctx context.Context, device string) (string, error) {
+		return Push(ctx, opts, device, "admin", "secret", "ntp server 10.0.0.1", 30*time.Second)
+	})
+	var ae *AppliedError
+	if err := summary.Errors[device.addr]; !errors.As(err, &ae) {
+		t.Errorf("got error %v, want an *AppliedError", err)
+	}
+	copies := 0
+	for _, cmd := range device.commands() {
+		if cmd == commitConfig {
+			copies++
+		}
+	}
+	if copies != 1 {
+		t.Errorf("configlet was copied %d times, want 1", copies)
+	}
+}
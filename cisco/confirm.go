@@ -0,0 +1,207 @@
+package cisco
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/cdevr/cpush/options"
+	"github.com/cdevr/cpush/utils"
+)
+
+// ConfirmMethod is how a device reverts a pushed configlet that isn't confirmed in time.
+type ConfirmMethod string
+
+const (
+	// RevertTimer uses "configure terminal revert timer". It needs the archive feature to be configured on the device.
+	RevertTimer ConfirmMethod = "revert"
+	// ReloadTimer uses "reload in". The device reloads with its startup config, which doesn't have the configlet.
+	ReloadTimer ConfirmMethod = "reload"
+)
+
+// ParseConfirmMethod parses "revert" or "reload".
+func ParseConfirmMethod(s string) (ConfirmMethod, error) {
+	switch m := ConfirmMethod(s); m {
+	case RevertTimer, ReloadTimer:
+		return m, nil
+	}
+	return "", fmt.Errorf("unknown confirm method %q, use %q or %q", s, RevertTimer, ReloadTimer)
+}
+
+// confirmTries is how many times confirming a push is tried over a fresh connection.
+const confirmTries = 3
+
+// RevertedError is returned by ConfirmedPush when a push wasn't confirmed, or its timer couldn't be cancelled. The
+// push must not be tried again before the device has reverted, see Retryable.
+type RevertedError struct {
+	Device string
+	Method ConfirmMethod
+	// Pending is true when the device hasn't reverted yet, but will when the timer expires.
+	Pending bool
+	Minutes int
+	Cause   error
+}
+
+func (e *RevertedError) Error() string {
+	if e.Pending {
+		return fmt.Sprintf("push to %q not confirmed: %v, the %s timer reverts it within %d minutes", e.Device, e.Cause, e.Method, e.Minutes)
+	}
+	return fmt.Sprintf("push to %q reverted: %v", e.Device, e.Cause)
+}
+
+func (e *RevertedError) Unwrap() error {
+	return e.Cause
+}
+
+// ConfirmedPush pushes a configlet to an ios device like a commit confirmed. Before the configlet is applied, a timer
+// is started that reverts it. After the push, cpush connects to the device again over a fresh SSH connection, runs the
+// verifications, and cancels the timer. So when the configlet cuts off management access, the device reverts it by
+// itself. The configuration is only written once the push is confirmed. If the push isn't confirmed, the error is a
+// *RevertedError.
+func ConfirmedPush(ctx context.Context, opts *options.Options, device string, username string, password string, configlet string, timeout time.Duration, method ConfirmMethod, minutes int, verifications []Verification) (string, error) {
+	if minutes < 1 {
+		return "", fmt.Errorf("confirm timer of %d minutes is too short", minutes)
+	}
+
+	scheduled := false
+	prepare := func(ctx context.Context, stdin io.Writer, output *utils.ThreadSafeBuffer) error {
+		if err := scheduleRevert(ctx, stdin, output, device, method, minutes); err != nil {
+			return err
+		}
+		scheduled = true
+		return nil
+	}
+
+	var result strings.Builder
+	output, applied, err := push(ctx, opts, device, username, password, configlet, timeout, prepare, false)
+	result.WriteString(output)
+	if err != nil && !applied {
+		if scheduled {
+			// Nothing was changed, so the timer can be cancelled. If that fails the timer is still pending, and pushing
+			// again would stack another change on top of it.
+			if cerr := confirmPush(ctx, opts, device, username, password, timeout, method, &result); cerr != nil {
+				return result.String(), &RevertedError{device, method, true, minutes, fmt.Errorf("%v, and %v", err, cerr)}
+			}
+		}
+		return result.String(), err
+	}
+
+	if err == nil {
+		err = verify(ctx, opts, device, username, password, timeout, verifications, &result)
+	}
+	if err != nil {
+		return result.String(), revertNow(ctx, opts, device, username, password, timeout, method, minutes, &result, err)
+	}
+
+	if err := confirmPush(ctx, opts, device, username, password, timeout, method, &result); err != nil {
+		return result.String(), &RevertedError{device, method, true, minutes, err}
+	}
+
+	output, err = Cmd(ctx, opts, device, username, password, wrCommand, timeout)
+	result.WriteString(output)
+	if err != nil {
+		return result.String(), fmt.Errorf("push confirmed, but failed to write the configuration on %q: %v", device, err)
+	}
+	result.WriteString("\npush confirmed\n")
+	return result.String(), nil
+}
+
+// scheduleRevert starts the timer that reverts the configuration, in an open shell.
+func scheduleRevert(ctx context.Context, stdin io.Writer, output *utils.ThreadSafeBuffer, device string, method ConfirmMethod, minutes int) error {
+	start := output.Len()
+	var cmd string
+	switch method {
+	case RevertTimer:
+		cmd = fmt.Sprintf("configure terminal revert timer %d", minutes)
+		if _, err := stdin.Write([]byte(cmd + "\r")); err != nil {
+			return fmt.Errorf("failed to run command %q on device %q: %v", cmd, device, err)
+		}
+		utils.WaitForPrompt(output, 10*time.Second, false)
+		if _, err := stdin.Write([]byte("end\r")); err != nil {
+			return fmt.Errorf("failed to run command %q on device %q: %v", "end", device, err)
+		}
+		utils.WaitForPrompt(output, 2*time.Second, false)
+		if seg := output.String()[start:]; !strings.Contains(seg, "(config)#") || strings.Contains(seg, "%") {
+			return fmt.Errorf("failed to start revert timer on %q, is archive configured?\n%s", device, seg)
+		}
+	case ReloadTimer:
+		cmd = fmt.Sprintf("reload in %d", minutes)
+		if _, err := stdin.Write([]byte(cmd + "\r")); err != nil {
+			return fmt.Errorf("failed to run command %q on device %q: %v", cmd, device, err)
+		}
+		utils.WaitFor(output, "]", 5*time.Second)
+		// Don't save the configuration, the startup config is what the device reverts to.
+		if strings.Contains(output.LastLine(), "yes/no") {
+			if _, err := stdin.Write([]byte("no\r")); err != nil {
+				return fmt.Errorf("failed to answer reload question on device %q: %v", device, err)
+			}
+			utils.WaitFor(output, "[confirm]", 5*time.Second)
+		}
+		if _, err := stdin.Write([]byte("\r")); err != nil {
+			return fmt.Errorf("failed to confirm reload on device %q: %v", device, err)
+		}
+		utils.WaitFor(output, "Reload scheduled", 5*time.Second)
+		if seg := output.String()[start:]; !strings.Contains(seg, "Reload scheduled") {
+			return fmt.Errorf("failed to schedule reload on %q:\n%s", device, seg)
+		}
+	default:
+		return fmt.Errorf("unknown confirm method %q", method)
+	}
+
+	if ctx.Err() != nil {
+		return fmt.Errorf("scheduling revert on %q aborted: %v", device, ctx.Err())
+	}
+	return nil
+}
+
+// confirmPush cancels the revert timer over a fresh connection. It's tried a few times, since the device might still
+// be busy applying the configlet. It runs on its own context, see recoveryContext.
+func confirmPush(ctx context.Context, opts *options.Options, device string, username string, password string, timeout time.Duration, method ConfirmMethod, result *strings.Builder) error {
+	ctx, cancel := recoveryContext(ctx)
+	defer cancel()
+
+	cmd := "configure confirm"
+	if method == ReloadTimer {
+		cmd = "reload cancel"
+	}
+
+	var err error
+	for try := 1; try <= confirmTries; try++ {
+		var output string
+		output, err = Cmd(ctx, opts, device, username, password, cmd, timeout)
+		if err == nil && strings.Contains(output, "%") {
+			err = fmt.Errorf("%q failed: %s", cmd, strings.TrimSpace(output))
+		}
+		if err == nil {
+			fmt.Fprintf(result, "\n%s:\n%s\n", cmd, output)
+			return nil
+		}
+		if ctx.Err() != nil || try == confirmTries {
+			break
+		}
+		select {
+		case <-time.After(5 * time.Second):
+		case <-ctx.Done():
+		}
+	}
+	return fmt.Errorf("failed to confirm over a new connection: %v", err)
+}
+
+// revertNow reverts the configlet right away, because cause made the push fail. With a reload timer that would mean
+// reloading right away, so the device is left to reload when the timer expires. It runs on its own context, see
+// recoveryContext.
+func revertNow(ctx context.Context, opts *options.Options, device string, username string, password string, timeout time.Duration, method ConfirmMethod, minutes int, result *strings.Builder, cause error) error {
+	if method != RevertTimer {
+		return &RevertedError{device, method, true, minutes, cause}
+	}
+	ctx, cancel := recoveryContext(ctx)
+	defer cancel()
+	output, err := Cmd(ctx, opts, device, username, password, "configure revert now", timeout)
+	fmt.Fprintf(result, "\nrevert:\n%s\n", output)
+	if err != nil || strings.Contains(output, "%") {
+		return &RevertedError{device, method, true, minutes, cause}
+	}
+	return &RevertedError{device, method, false, minutes, cause}
+}
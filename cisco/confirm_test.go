@@ -0,0 +1,113 @@
+package cisco
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cdevr/cpush/utils"
+)
+
+// fakeDevice answers the lines written to it with canned responses in the output buffer, a little later like a real
+// device would.
+type fakeDevice struct {
+	output    *utils.ThreadSafeBuffer
+	responses map[string]string
+	received  []string
+}
+
+func (d *fakeDevice) Write(p []byte) (int, error) {
+	line := strings.TrimSuffix(string(p), "\r")
+	d.received = append(d.received, line)
+	time.AfterFunc(10*time.Millisecond, func() {
+		d.output.Write([]byte(line + "\r\n" + d.responses[line]))
+	})
+	return len(p), nil
+}
+
+func TestScheduleRevert(t *testing.T) {
+	for _, test := range []struct {
+		Method    ConfirmMethod
+		Responses map[string]string
+		Sent      []string
+		OK        bool
+	}{
+		{
+			ReloadTimer,
+			map[string]string{
+				"reload in 5": "System configuration has been modified. Save? [yes/no]: ",
+				"no":          "Proceed with reload? [confirm]",
+				"":            "Reload scheduled in 5 minutes by admin on vty0\r\nrtr1#",
+			},
+			[]string{"reload in 5", "no", ""},
+			true,
+		},
+		{
+			ReloadTimer,
+			map[string]string{
+				"reload in 5": "Proceed with reload? [confirm]",
+				"":            "Reload scheduled in 5 minutes by admin on vty0\r\nrtr1#",
+			},
+			[]string{"reload in 5", ""},
+			true,
+		},
+		{
+			RevertTimer,
+			map[string]string{
+				"configure terminal revert timer 5": "Rollback Confirmed Change: Backing up current running config to flash:rollback-1\r\nrtr1(config)#",
+				"end":                               "rtr1#",
+			},
+			[]string{"configure terminal revert timer 5", "end"},
+			true,
+		},
+		{
+			RevertTimer,
+			map[string]string{
+				"configure terminal revert timer 5": "% Archive path is not configured\r\nrtr1#",
+				"end":                               "rtr1#",
+			},
+			nil,
+			false,
+		},
+	} {
+		var output utils.ThreadSafeBuffer
+		device := &fakeDevice{output: &output, responses: test.Responses}
+		err := scheduleRevert(context.Background(), device, &output, "rtr1", test.Method, 5)
+		if (err == nil) != test.OK {
+			t.Errorf("scheduleRevert(%s) got error %v, want ok %v", test.Method, err, test.OK)
+		}
+		if test.Sent != nil && strings.Join(device.received, "|") != strings.Join(test.Sent, "|") {
+			t.Errorf("scheduleRevert(%s) sent %q, want %q", test.Method, device.received, test.Sent)
+		}
+	}
+}
+
+func TestRevertedError(t *testing.T) {
+	cause := fmt.Errorf("connection refused")
+	var err error = &RevertedError{"rtr1", ReloadTimer, true, 5, cause}
+
+	var reverted *RevertedError
+	if !errors.As(err, &reverted) || !reverted.Pending {
+		t.Errorf("expected a pending RevertedError, got %v", err)
+	}
+	if !errors.Is(err, cause) {
+		t.Errorf("RevertedError doesn't wrap its cause")
+	}
+	if want := "reverts it within 5 minutes"; !strings.Contains(err.Error(), want) {
+		t.Errorf("got %q, want it to contain %q", err.Error(), want)
+	}
+}
+
+func TestParseConfirmMethod(t *testing.T) {
+	for _, s := range []string{"revert", "reload"} {
+		if m, err := ParseConfirmMethod(s); err != nil || string(m) != s {
+			t.Errorf("ParseConfirmMethod(%q) = %q, %v", s, m, err)
+		}
+	}
+	if _, err := ParseConfirmMethod("eem"); err == nil {
+		t.Errorf("ParseConfirmMethod(%q) didn't fail", "eem")
+	}
+}
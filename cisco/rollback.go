@@ -0,0 +1,190 @@
+package cisco
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/cdevr/cpush/options"
+	"github.com/cdevr/cpush/utils"
+)
+
+// BackupPrefix is the start of the filename on flash that the running config is saved to before a safe push.
+const BackupPrefix = "flash:cpush-pre-"
+
+// Verification is a command that is run after a push, whose output has to match a pattern.
+type Verification struct {
+	Command string
+	Expect  *regexp.Regexp
+}
+
+// ParseVerification parses a verification of the form "command =~ pattern". The pattern is a regular expression in
+// multiline mode, so ^ and $ match at the start and end of lines. Without a pattern any output is accepted.
+func ParseVerification(s string) (Verification, error) {
+	cmd, pattern, found := strings.Cut(s, "=~")
+	cmd = strings.TrimSpace(cmd)
+	if cmd == "" {
+		return Verification{}, fmt.Errorf("no command in verification %q", s)
+	}
+	if !found {
+		return Verification{Command: cmd}, nil
+	}
+	re, err := regexp.Compile("(?m)" + strings.TrimSpace(pattern))
+	if err != nil {
+		return Verification{}, fmt.Errorf("invalid pattern in verification %q: %v", s, err)
+	}
+	return Verification{Command: cmd, Expect: re}, nil
+}
+
+func (v Verification) String() string {
+	if v.Expect == nil {
+		return v.Command
+	}
+	return fmt.Sprintf("%s =~ %s", v.Command, strings.TrimPrefix(v.Expect.String(), "(?m)"))
+}
+
+// Check returns an error if the output of the command doesn't match the expected pattern.
+func (v Verification) Check(output string) error {
+	if v.Expect != nil && !v.Expect.MatchString(output) {
+		return fmt.Errorf("output of %q doesn't match %q", v.Command, strings.TrimPrefix(v.Expect.String(), "(?m)"))
+	}
+	return nil
+}
+
+// backupRunningConfig copies the running config to a file on the device, in an open shell.
+func backupRunningConfig(ctx context.Context, stdin io.Writer, output *utils.ThreadSafeBuffer, device string, fn string) error {
+	start := output.Len()
+	copyCmd := "copy running-config " + fn
+	if _, err := stdin.Write([]byte(copyCmd + "\r")); err != nil {
+		return fmt.Errorf("failed to run command %q on device %q: %v", copyCmd, device, err)
+	}
+	utils.WaitFor(output, "?", 5*time.Second)
+	// Accept the suggested destination filename.
+	if _, err := stdin.Write([]byte("\r")); err != nil {
+		return fmt.Errorf("failed to confirm backup on device %q: %v", device, err)
+	}
+	utils.WaitFor(output, "bytes copied", 30*time.Second)
+	utils.WaitForPrompt(output, 2*time.Second, false)
+
+	if ctx.Err() != nil {
+		return fmt.Errorf("backing up running config on %q aborted: %v", device, ctx.Err())
+	}
+	if !strings.Contains(output.String()[start:], "bytes copied") {
+		return fmt.Errorf("failed to back up running config on %q to %s:\n%s", device, fn, output.String()[start:])
+	}
+	return nil
+}
+
+// SafePush pushes a configlet to an ios device with a way back. The running config is saved to flash first, then
+// the configlet is applied and the verifications are run. Only when they all pass is the configuration written to
+// the startup config. When the device rejects the configlet or a verification fails, the saved configuration is
+// restored with configure replace.
+func SafePush(ctx context.Context, opts *options.Options, device string, username string, password string, configlet string, timeout time.Duration, verifications []Verification) (string, error) {
+	backup := BackupPrefix + time.Now().Format("20060102-150405")
+
+	var result strings.Builder
+	prepare := func(ctx context.Context, stdin io.Writer, output *utils.ThreadSafeBuffer) error {
+		return backupRunningConfig(ctx, stdin, output, device, backup)
+	}
+	output, applied, err := push(ctx, opts, device, username, password, configlet, timeout, prepare, false)
+	result.WriteString(output)
+	if err != nil {
+		if !applied {
+			return result.String(), err
+		}
+		return result.String(), rollback(ctx, opts, device, username, password, timeout, backup, &result, err)
+	}
+
+	if err := verify(ctx, opts, device, username, password, timeout, verifications, &result); err != nil {
+		return result.String(), rollback(ctx, opts, device, username, password, timeout, backup, &result, err)
+	}
+
+	output, err = Cmd(ctx, opts, device, username, password, wrCommand, timeout)
+	result.WriteString(output)
+	if err != nil {
+		return result.String(), fmt.Errorf("configlet verified, but failed to write the configuration on %q: %v", device, err)
+	}
+	removeBackup(ctx, opts, device, username, password, timeout, backup)
+	return result.String(), nil
+}
+
+// verify runs the verifications on a device, and adds their output to result.
+func verify(ctx context.Context, opts *options.Options, device string, username string, password string, timeout time.Duration, verifications []Verification, result *strings.Builder) error {
+	for _, v := range verifications {
+		output, err := Cmd(ctx, opts, device, username, password, v.Command, timeout)
+		fmt.Fprintf(result, "\nverify %q:\n%s\n", v.Command, output)
+		if err == nil {
+			err = v.Check(output)
+		}
+		if err != nil {
+			return fmt.Errorf("verification failed: %v", err)
+		}
+	}
+	return nil
+}
+
+// recoveryTimeout is how long rolling back, reverting or confirming a push can take. It doesn't count against the
+// timeout of the push, which might be what made it fail.
+const recoveryTimeout = 5 * time.Minute
+
+// recoveryContext returns the context to roll back, revert or confirm a push on. It isn't done when ctx is, since
+// stopping halfway would leave the device with configuration that's neither verified nor saved.
+func recoveryContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(detachedContext{ctx}, recoveryTimeout)
+}
+
+// detachedContext has the values of a context, but not its deadline and cancellation.
+type detachedContext struct {
+	context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}       { return nil }
+func (detachedContext) Err() error                  { return nil }
+
+// rollback restores the backup with configure replace after cause made the push fail. It returns the error to report.
+// It runs on its own context, see recoveryContext.
+func rollback(ctx context.Context, opts *options.Options, device string, username string, password string, timeout time.Duration, backup string, result *strings.Builder, cause error) error {
+	ctx, cancel := recoveryContext(ctx)
+	defer cancel()
+
+	replace := fmt.Sprintf("configure replace %s force", backup)
+	output, err := Cmd(ctx, opts, device, username, password, replace, timeout)
+	fmt.Fprintf(result, "\nrollback:\n%s\n", output)
+	if err == nil && !strings.Contains(output, "Rollback Done") {
+		err = fmt.Errorf("configure replace didn't report success")
+	}
+	if err != nil {
+		return &RolledBackError{backup, cause, err}
+	}
+	removeBackup(ctx, opts, device, username, password, timeout, backup)
+	return &RolledBackError{backup, cause, nil}
+}
+
+// RolledBackError is returned by SafePush when the push failed after the configlet was applied, and it was rolled
+// back.
+type RolledBackError struct {
+	Backup string
+	Cause  error
+	// Err is why rolling back failed, or nil if the previous configuration was restored.
+	Err error
+}
+
+func (e *RolledBackError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%v, and rolling back to %s FAILED: %v", e.Cause, e.Backup, e.Err)
+	}
+	return fmt.Sprintf("%v, rolled back to the previous configuration", e.Cause)
+}
+
+func (e *RolledBackError) Unwrap() error {
+	return e.Cause
+}
+
+// removeBackup deletes the backup from the device. Failing to do so isn't fatal, the backup is just left behind.
+func removeBackup(ctx context.Context, opts *options.Options, device string, username string, password string, timeout time.Duration, backup string) {
+	Cmd(ctx, opts, device, username, password, "delete /force "+backup, timeout)
+}
@@ -0,0 +1,201 @@
+package cisco
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cdevr/cpush/options"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestParseVerification(t *testing.T) {
+	for _, test := range []struct {
+		Input   string
+		Command string
+		Output  string
+		OK      bool
+	}{
+		{"show ip int brief =~ Loopback99 .* up", "show ip int brief", "Loopback99   1.0.0.1   YES manual up   up", true},
+		{"show ip int brief =~ Loopback99 .* up", "show ip int brief", "Loopback0   1.0.0.1   YES manual up   up", false},
+		{"show bgp sum =~ ^10\\.0\\.0\\.1 .* \\d+$", "show bgp sum", "header\n10.0.0.1 4 65000 1 1 1 0 0 01:00:00 12\n", true},
+		{"show bgp sum =~ ^10\\.0\\.0\\.1 .* \\d+$", "show bgp sum", "header\n10.0.0.1 4 65000 1 1 1 0 0 01:00:00 Idle\n", false},
+		{"show clock", "show clock", "anything", true},
+	} {
+		v, err := ParseVerification(test.Input)
+		if err != nil {
+			t.Errorf("ParseVerification(%q) failed: %v", test.Input, err)
+			continue
+		}
+		if v.Command != test.Command {
+			t.Errorf("ParseVerification(%q): got command %q want %q", test.Input, v.Command, test.Command)
+		}
+		if err := v.Check(test.Output); (err == nil) != test.OK {
+			t.Errorf("%q.Check(%q): got error %v, want ok %v", test.Input, test.Output, err, test.OK)
+		}
+	}
+
+	for _, bad := range []string{"=~ up", "show clock =~ ("} {
+		if _, err := ParseVerification(bad); err == nil {
+			t.Errorf("ParseVerification(%q) didn't fail", bad)
+		}
+	}
+}
+
+// iosDevice is an SSH server with a shell that answers commands like an ios device, with canned responses.
+type iosDevice struct {
+	addr string
+	// slow are commands that take this long to answer.
+	slow      map[string]time.Duration
+	responses map[string]string
+	// hangup is a command after which the device drops the session, before it's done answering.
+	hangup string
+
+	mu       sync.Mutex
+	received []string
+}
+
+func startIOSDevice(t *testing.T, responses map[string]string, slow map[string]time.Duration, hangup string) *iosDevice {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate host key: %v", err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatalf("failed to make signer: %v", err)
+	}
+	config := &ssh.ServerConfig{NoClientAuth: true}
+	config.AddHostKey(signer)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { l.Close() })
+	d := &iosDevice{addr: l.Addr().String(), responses: responses, slow: slow, hangup: hangup}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go d.serve(conn, config)
+		}
+	}()
+	return d
+}
+
+func (d *iosDevice) serve(conn net.Conn, config *ssh.ServerConfig) {
+	defer conn.Close()
+	_, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	for nc := range chans {
+		if nc.ChannelType() != "session" {
+			nc.Reject(ssh.UnknownChannelType, "only sessions")
+			continue
+		}
+		ch, creqs, err := nc.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			for req := range creqs {
+				req.Reply(req.Type == "pty-req" || req.Type == "shell", nil)
+			}
+		}()
+		go d.shell(ch)
+	}
+}
+
+func (d *iosDevice) shell(ch ssh.Channel) {
+	defer ch.Close()
+	ch.Write([]byte("rtr1#"))
+	var line []byte
+	tclsh := false
+	buf := make([]byte, 1024)
+	for {
+		n, err := ch.Read(buf)
+		if err != nil {
+			return
+		}
+		for _, c := range buf[:n] {
+			if c != '\r' && c != '\n' {
+				line = append(line, c)
+				continue
+			}
+			cmd := strings.TrimSpace(string(line))
+			line = line[:0]
+			if cmd == "" {
+				continue
+			}
+			d.mu.Lock()
+			d.received = append(d.received, cmd)
+			d.mu.Unlock()
+			switch {
+			case cmd == startTclSh:
+				tclsh = true
+			case cmd == quitTclSh && tclsh:
+				tclsh = false
+			case cmd == exitCommand:
+				ch.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{0}))
+				return
+			}
+			time.Sleep(d.slow[cmd])
+			if cmd == d.hangup {
+				ch.Write([]byte(d.responses[cmd]))
+				return
+			}
+			ch.Write([]byte(d.responses[cmd] + "\r\nrtr1#"))
+		}
+	}
+}
+
+func (d *iosDevice) commands() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]string{}, d.received...)
+}
+
+func TestRollbackAfterDeadline(t *testing.T) {
+	device := startIOSDevice(t, map[string]string{
+		"configure replace flash:backup force": "Rollback Done",
+	}, map[string]time.Duration{
+		"show bgp summary": 3 * time.Second,
+	}, "")
+	opts := options.NewOptions()
+	opts.Dialer = (&net.Dialer{}).DialContext
+
+	// The verification takes longer than the push is allowed to, like when the deadline passes during verification.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	var result strings.Builder
+	verifications := []Verification{{Command: "show bgp summary"}}
+	cause := verify(ctx, opts, device.addr, "admin", "secret", 10*time.Second, verifications, &result)
+	if cause == nil {
+		t.Fatalf("verification didn't hit the deadline")
+	}
+
+	err := rollback(ctx, opts, device.addr, "admin", "secret", 10*time.Second, "flash:backup", &result, cause)
+	var rb *RolledBackError
+	if !errors.As(err, &rb) || rb.Err != nil {
+		t.Fatalf("got %v, want a completed rollback\n%s", err, result.String())
+	}
+	want := "configure replace flash:backup force"
+	found := false
+	for _, cmd := range device.commands() {
+		found = found || cmd == want
+	}
+	if !found {
+		t.Errorf("device got %q, want %q", device.commands(), want)
+	}
+}
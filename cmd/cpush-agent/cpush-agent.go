@@ -0,0 +1,128 @@
+// cpush-agent holds credentials for cpush and rcheck in memory, like ssh-agent does for keys.
+//
+// Start it with
+//
+//	eval $(cpush-agent)
+//
+// which starts the agent in the background and sets $CPUSH_AUTH_SOCK, so cpush and rcheck ask the agent for passwords
+// instead of caching them in /dev/shm.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/cdevr/cpush/agent"
+)
+
+var (
+	socket      = flag.String("socket", "", "unix socket to listen on, defaults to $XDG_RUNTIME_DIR/cpush-agent.sock or a directory of the user in the temporary directory")
+	ttl         = flag.Duration("ttl", 8*time.Hour, "forget credentials this long after they were added, 0 to keep them")
+	idleTimeout = flag.Duration("idle_timeout", time.Hour, "forget credentials that weren't used for this long, 0 to keep them")
+	foreground  = flag.Bool("foreground", false, "don't start the agent in the background, and log to stderr")
+	kill        = flag.Bool("k", false, "stop the agent at $CPUSH_AUTH_SOCK, or --socket")
+	removeAll   = flag.Bool("D", false, "make the agent at $CPUSH_AUTH_SOCK, or --socket, forget all credentials")
+)
+
+func main() {
+	flag.Parse()
+
+	if *socket == "" {
+		*socket = os.Getenv(agent.SocketEnv)
+	}
+	if *kill || *removeAll {
+		if *socket == "" {
+			log.Fatalf("no agent, $%s isn't set", agent.SocketEnv)
+		}
+		c := &agent.Client{Socket: *socket}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if *removeAll {
+			if err := c.RemoveAll(ctx); err != nil {
+				log.Fatalf("%v", err)
+			}
+			fmt.Fprintln(os.Stderr, "All credentials removed.")
+			return
+		}
+		if err := c.Stop(ctx); err != nil {
+			log.Fatalf("%v", err)
+		}
+		fmt.Printf("unset %s;\n", agent.SocketEnv)
+		return
+	}
+	if *socket == "" {
+		*socket = agent.DefaultSocket()
+	}
+
+	if !*foreground {
+		pid, err := background()
+		if err != nil {
+			log.Fatalf("failed to start agent: %v", err)
+		}
+		fmt.Printf("%s=%s; export %s;\n", agent.SocketEnv, *socket, agent.SocketEnv)
+		fmt.Printf("echo Agent pid %d;\n", pid)
+		return
+	}
+
+	l, err := agent.Listen(*socket)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	defer os.Remove(*socket)
+
+	s := agent.NewServer(*ttl, *idleTimeout)
+	s.Logf = log.Printf
+	go func() {
+		sigs := make(chan os.Signal, 1)
+		signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+		<-sigs
+		s.Stop()
+	}()
+	log.Printf("listening on %q", *socket)
+	if err := s.Serve(l); err != nil {
+		log.Fatalf("%v", err)
+	}
+}
+
+// background starts the agent again in the foreground in a new session, and waits until it listens.
+func background() (int, error) {
+	self, err := os.Executable()
+	if err != nil {
+		return 0, err
+	}
+	cmd := exec.Command(self,
+		"--foreground",
+		"--socket", *socket,
+		"--ttl", ttl.String(),
+		"--idle_timeout", idleTimeout.String(),
+	)
+	// In a new session, the agent keeps running when the terminal it was started from is closed.
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if err := cmd.Start(); err != nil {
+		return 0, err
+	}
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(50 * time.Millisecond) {
+		select {
+		case err := <-exited:
+			return 0, fmt.Errorf("agent exited: %v", err)
+		default:
+		}
+		if conn, err := net.Dial("unix", *socket); err == nil {
+			conn.Close()
+			return cmd.Process.Pid, nil
+		}
+	}
+	cmd.Process.Kill()
+	return 0, fmt.Errorf("agent didn't listen on %q in time", *socket)
+}
@@ -0,0 +1,120 @@
+// Package configlet renders configlet templates per device.
+//
+// Configlets are Go text/templates. A template can use the name of the device as {{.Device}}, variables of the
+// device from a YAML or CSV file as {{.Vars.loopback}}, and facts that were parsed from the output of a command on the
+// device as {{.Fact "VERSION"}}.
+package configlet
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Vars are the variables of a device.
+type Vars map[string]string
+
+// Data is what a template is executed with.
+type Data struct {
+	Device string
+	Vars   Vars
+	// Facts are the rows that were parsed from the output of a command on the device.
+	Facts []map[string]interface{}
+}
+
+// Fact returns a field of the first fact row, or an error if there's no such field.
+func (d Data) Fact(field string) (string, error) {
+	if len(d.Facts) == 0 {
+		return "", fmt.Errorf("no facts for device %q", d.Device)
+	}
+	v, ok := d.Facts[0][field]
+	if !ok {
+		return "", fmt.Errorf("no fact %q for device %q", field, d.Device)
+	}
+	return fmt.Sprintf("%v", v), nil
+}
+
+// Template is a configlet template.
+type Template struct {
+	t *template.Template
+}
+
+// Parse parses a configlet template. Executing it fails when it uses a variable that a device doesn't have, rather
+// than pushing "<no value>".
+func Parse(text string) (*Template, error) {
+	t, err := template.New("configlet").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse configlet template: %v", err)
+	}
+	return &Template{t}, nil
+}
+
+// Render renders the configlet for a device.
+func (t *Template) Render(device string, vars Vars, facts []map[string]interface{}) (string, error) {
+	if vars == nil {
+		vars = Vars{}
+	}
+	var b strings.Builder
+	if err := t.t.Execute(&b, Data{device, vars, facts}); err != nil {
+		return "", fmt.Errorf("failed to render configlet for %q: %v", device, err)
+	}
+	return b.String(), nil
+}
+
+// LoadVars reads the variables of devices from a YAML or CSV file.
+//
+// A YAML file maps device names to their variables. A CSV file has a header with the variable names, and a row per
+// device. The device name is in the "device" column, or the first column if there's none.
+func LoadVars(fn string) (map[string]Vars, error) {
+	data, err := os.ReadFile(fn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read variables file %q: %v", fn, err)
+	}
+
+	var result map[string]Vars
+	switch strings.ToLower(filepath.Ext(fn)) {
+	case ".csv":
+		result, err = parseCSVVars(string(data))
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &result)
+	default:
+		return nil, fmt.Errorf("variables file %q isn't .yaml, .yml or .csv", fn)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse variables file %q: %v", fn, err)
+	}
+	return result, nil
+}
+
+func parseCSVVars(data string) (map[string]Vars, error) {
+	records, err := csv.NewReader(strings.NewReader(data)).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("no header")
+	}
+
+	header := records[0]
+	deviceColumn := 0
+	for i, name := range header {
+		if name == "device" {
+			deviceColumn = i
+		}
+	}
+
+	result := map[string]Vars{}
+	for _, record := range records[1:] {
+		vars := Vars{}
+		for i, value := range record {
+			vars[header[i]] = value
+		}
+		result[record[deviceColumn]] = vars
+	}
+	return result, nil
+}
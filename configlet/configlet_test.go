@@ -0,0 +1,59 @@
+package configlet
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/go-test/deep"
+)
+
+func TestLoadVars(t *testing.T) {
+	want := map[string]Vars{
+		"rtr1": {"loopback": "10.255.0.1", "site": "ams"},
+		"rtr2": {"loopback": "10.255.0.2", "site": "fra"},
+	}
+
+	got, err := LoadVars("testdata/vars.yaml")
+	if err != nil {
+		t.Fatalf("failed to load yaml variables: %v", err)
+	}
+	if diff := deep.Equal(got, want); diff != nil {
+		t.Errorf("yaml variables: %v", diff)
+	}
+
+	got, err = LoadVars("testdata/vars.csv")
+	if err != nil {
+		t.Fatalf("failed to load csv variables: %v", err)
+	}
+	// The device column is a variable as well.
+	wantCSV := map[string]Vars{
+		"rtr1": {"device": "rtr1", "loopback": "10.255.0.1", "site": "ams"},
+		"rtr2": {"device": "rtr2", "loopback": "10.255.0.2", "site": "fra"},
+	}
+	if diff := deep.Equal(got, wantCSV); diff != nil {
+		t.Errorf("csv variables: %v", diff)
+	}
+}
+
+func TestRender(t *testing.T) {
+	tmpl, err := Parse("hostname {{.Device}}\ninterface Loopback0\n ip address {{.Vars.loopback}} 255.255.255.255\nsnmp-server location {{.Vars.site}} {{.Fact \"VERSION\"}}")
+	if err != nil {
+		t.Fatalf("failed to parse template: %v", err)
+	}
+
+	got, err := tmpl.Render("rtr1", Vars{"loopback": "10.255.0.1", "site": "ams"}, []map[string]interface{}{{"VERSION": "15.2(4)M"}})
+	if err != nil {
+		t.Fatalf("failed to render: %v", err)
+	}
+	want := "hostname rtr1\ninterface Loopback0\n ip address 10.255.0.1 255.255.255.255\nsnmp-server location ams 15.2(4)M"
+	if got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+
+	if _, err := tmpl.Render("rtr2", Vars{"site": "fra"}, []map[string]interface{}{{"VERSION": "15.2(4)M"}}); err == nil || !strings.Contains(err.Error(), "loopback") {
+		t.Errorf("expected an error about the missing loopback variable, got %v", err)
+	}
+	if _, err := tmpl.Render("rtr1", Vars{"loopback": "10.255.0.1", "site": "ams"}, nil); err == nil {
+		t.Errorf("expected an error about missing facts")
+	}
+}
@@ -0,0 +1,89 @@
+package credentials
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"syscall"
+
+	"github.com/cdevr/cpush/agent"
+
+	"golang.org/x/term"
+)
+
+// Agent is a provider with the credentials held by a cpush-agent. A credential that the agent doesn't have is asked
+// for and given to the agent, so it's not asked for again until the agent forgets it. It's safe for concurrent use.
+type Agent struct {
+	Client *agent.Client
+	// Ask asks for a credential that the agent doesn't have.
+	Ask func(name string) (Credential, error)
+
+	mu sync.Mutex
+	// cache holds the credentials for the rest of the run, so they don't expire halfway.
+	cache map[string]Credential
+}
+
+// NewAgent returns a provider with the credentials of the agent on socket, that asks for passwords on the terminal.
+func NewAgent(socket string) *Agent {
+	return &Agent{Client: &agent.Client{Socket: socket}, Ask: askPassword}
+}
+
+// AgentSocket returns the socket of the running agent from $CPUSH_AUTH_SOCK, or the default one.
+func AgentSocket() string {
+	if socket := os.Getenv(agent.SocketEnv); socket != "" {
+		return socket
+	}
+	return agent.DefaultSocket()
+}
+
+func (a *Agent) Get(ctx context.Context, name string) (Credential, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if c, ok := a.cache[name]; ok {
+		return c, nil
+	}
+
+	ac, err := a.Client.Get(ctx, name)
+	if err == nil {
+		return a.remember(name, Credential(ac)), nil
+	}
+	if !errors.Is(err, agent.ErrNotFound) {
+		// Non-fatal error, the credential is asked for instead.
+		log.Printf("failed to get credential %q from agent at %q: %v", name, a.Client.Socket, err)
+	}
+
+	c, err := a.Ask(name)
+	if err != nil {
+		return Credential{}, err
+	}
+	if err := a.Client.Set(ctx, name, agent.Credential(c)); err != nil {
+		log.Printf("failed to give credential %q to agent at %q: %v", name, a.Client.Socket, err)
+	}
+	return a.remember(name, c), nil
+}
+
+func (a *Agent) remember(name string, c Credential) Credential {
+	if a.cache == nil {
+		a.cache = map[string]Credential{}
+	}
+	a.cache[name] = c
+	return c
+}
+
+// askPassword asks for the password of a credential on the terminal.
+func askPassword(name string) (Credential, error) {
+	if name == DefaultName {
+		fmt.Print("Please enter password: ")
+	} else {
+		fmt.Printf("Please enter password for %q: ", name)
+	}
+	password, err := term.ReadPassword(syscall.Stdin)
+	fmt.Println()
+	if err != nil {
+		return Credential{}, fmt.Errorf("failed to read password: %w", err)
+	}
+	return Credential{Password: string(password)}, nil
+}
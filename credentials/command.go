@@ -0,0 +1,73 @@
+package credentials
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// Command is a provider that runs a command, like pass or gopass, to get a credential. It's run once per name, and
+// one at a time, so a password manager only asks to unlock once.
+type Command struct {
+	args []string
+
+	mu    sync.Mutex
+	cache map[string]Credential
+}
+
+// NewCommand returns a provider that runs a command. A %s in its arguments is replaced by the name of the credential.
+//
+// The first line of the output is the password. A later line "login: name", "user: name" or "username: name" is the
+// username, like in the entries of pass and gopass.
+func NewCommand(args []string) *Command {
+	return &Command{args: args, cache: map[string]Credential{}}
+}
+
+func (c *Command) Get(ctx context.Context, name string) (Credential, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cred, ok := c.cache[name]; ok {
+		return cred, nil
+	}
+
+	var args []string
+	for _, a := range c.args {
+		args = append(args, strings.ReplaceAll(a, "%s", name))
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return Credential{}, fmt.Errorf("%q failed: %v: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+
+	cred := parseEntry(stdout.String())
+	if cred.Password == "" {
+		return Credential{}, fmt.Errorf("%q returned no password", strings.Join(args, " "))
+	}
+	c.cache[name] = cred
+	return cred, nil
+}
+
+// parseEntry parses the output of a password manager: a password, and maybe a username.
+func parseEntry(output string) Credential {
+	lines := strings.Split(strings.ReplaceAll(output, "\r\n", "\n"), "\n")
+	cred := Credential{Password: lines[0]}
+	for _, line := range lines[1:] {
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		switch strings.ToLower(strings.TrimSpace(key)) {
+		case "login", "user", "username":
+			if cred.Username == "" {
+				cred.Username = strings.TrimSpace(value)
+			}
+		}
+	}
+	return cred
+}
@@ -0,0 +1,197 @@
+// Package credentials provides the usernames and passwords to log in to devices with.
+//
+// A Provider returns credentials by name. Providers are the password cache in /dev/shm, a cpush-agent, an environment
+// variable, an external command like pass or gopass, or a file that is encrypted with a master passphrase. PerDevice turns a
+// provider into credentials per device, with the name of the credential of each device from the inventory.
+package credentials
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/cdevr/cpush/agent"
+	"github.com/cdevr/cpush/pwcache"
+
+	"golang.org/x/term"
+)
+
+// DefaultName is the name of the credential of devices that don't have one.
+const DefaultName = "default"
+
+// ErrNotFound is returned when a provider doesn't have a credential.
+var ErrNotFound = errors.New("credential not found")
+
+// Credential is a username and password. An empty username means the username isn't part of the credential, and
+// another one, like the one from --username, is used.
+type Credential struct {
+	Username string
+	Password string
+}
+
+// Provider returns credentials by name.
+type Provider interface {
+	Get(ctx context.Context, name string) (Credential, error)
+}
+
+// Static is a provider that returns the same credential for every name.
+type Static Credential
+
+func (s Static) Get(ctx context.Context, name string) (Credential, error) {
+	return Credential(s), nil
+}
+
+// Shm returns the password from the cache in /dev/shm as provider for every name. If it's not cached, it asks for the
+// password now. When a cpush-agent runs, at $CPUSH_AUTH_SOCK, the credentials are held by the agent instead, see
+// Agent.
+func Shm(clearCache bool, usePwCache bool) (Provider, error) {
+	if socket := os.Getenv(agent.SocketEnv); socket != "" && usePwCache {
+		a := NewAgent(socket)
+		if clearCache {
+			if err := a.Client.RemoveAll(context.Background()); err != nil {
+				return nil, fmt.Errorf("failed to clear credentials in agent: %w", err)
+			}
+		}
+		return a, nil
+	}
+	password, err := pwcache.GetPassword(clearCache, usePwCache)
+	if err != nil {
+		return nil, err
+	}
+	return Static{Password: password}, nil
+}
+
+// Env is a provider that returns the password in an environment variable for every name. The username is in the
+// variable with _USERNAME appended, if it's set.
+type Env string
+
+func (e Env) Get(ctx context.Context, name string) (Credential, error) {
+	password, ok := os.LookupEnv(string(e))
+	if !ok {
+		return Credential{}, fmt.Errorf("environment variable $%s with the password isn't set", string(e))
+	}
+	return Credential{Username: os.Getenv(string(e) + "_USERNAME"), Password: password}, nil
+}
+
+// Open returns a provider from a specification, which is one of:
+//   - env:VARIABLE for the password in an environment variable
+//   - pass:PREFIX for the password in the pass entry PREFIX/name
+//   - gopass:PREFIX for the password in the gopass entry PREFIX/name
+//   - cmd:COMMAND for the output of a command, in which %s is replaced by the name
+//   - file:FILE for a file that is encrypted with a master passphrase, see OpenFile
+//   - agent or agent:SOCKET for the credentials held by a cpush-agent, see Agent
+//
+// The password cache in /dev/shm isn't opened here, since it needs its flags, see Shm.
+func Open(spec string) (Provider, error) {
+	if spec == "agent" {
+		return NewAgent(AgentSocket()), nil
+	}
+	kind, arg, ok := strings.Cut(spec, ":")
+	if !ok || arg == "" {
+		return nil, fmt.Errorf("invalid credential provider %q, want env:, pass:, gopass:, cmd:, file: or agent", spec)
+	}
+	switch kind {
+	case "env":
+		return Env(arg), nil
+	case "pass":
+		return NewCommand([]string{"pass", "show", strings.TrimSuffix(arg, "/") + "/%s"}), nil
+	case "gopass":
+		return NewCommand([]string{"gopass", "show", strings.TrimSuffix(arg, "/") + "/%s"}), nil
+	case "cmd":
+		args := strings.Fields(arg)
+		return NewCommand(args), nil
+	case "file":
+		return OpenFile(arg, nil)
+	case "agent":
+		return NewAgent(arg), nil
+	default:
+		return nil, fmt.Errorf("unknown credential provider %q, want env:, pass:, gopass:, cmd:, file: or agent", kind)
+	}
+}
+
+// PerDevice returns the credentials of devices. It's safe for concurrent use if its provider is.
+type PerDevice struct {
+	Provider Provider
+	// Lookup returns the name of the credential of a device, or "" for the default, and the username to use if the
+	// credential has none.
+	Lookup func(device string) (name string, username string)
+	// Fallback are the names of the credentials to try, in order, when a device refuses its own credential.
+	Fallback []string
+
+	mu       sync.Mutex
+	loggedIn map[string]string
+}
+
+// Get returns the credential of a device.
+func (p *PerDevice) Get(ctx context.Context, device string) (Credential, error) {
+	return p.GetNamed(ctx, device, p.Names(device)[0])
+}
+
+// Names returns the name of the credential of a device, followed by the fallback credentials.
+func (p *PerDevice) Names(device string) []string {
+	name, _ := p.Lookup(device)
+	if name == "" {
+		name = DefaultName
+	}
+	result := []string{name}
+	for _, f := range p.Fallback {
+		if f != name {
+			result = append(result, f)
+		}
+	}
+	return result
+}
+
+// GetNamed returns a credential for a device.
+func (p *PerDevice) GetNamed(ctx context.Context, device string, name string) (Credential, error) {
+	_, username := p.Lookup(device)
+	c, err := p.Provider.Get(ctx, name)
+	if err != nil {
+		return Credential{}, fmt.Errorf("failed to get credential %q for device %q: %w", name, device, err)
+	}
+	if c.Username == "" {
+		c.Username = username
+	}
+	return c, nil
+}
+
+// LoggedIn records the credential a device accepted, see LoggedInWith.
+func (p *PerDevice) LoggedIn(device string, name string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.loggedIn == nil {
+		p.loggedIn = map[string]string{}
+	}
+	p.loggedIn[device] = name
+}
+
+// LoggedInWith returns the name of the credential a device accepted, or "" if it wasn't logged in to.
+func (p *PerDevice) LoggedInWith(device string) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.loggedIn[device]
+}
+
+// Ask asks for a username and a password on the terminal. The username can be left empty.
+func Ask() (Credential, error) {
+	fmt.Print("Username (empty for the default): ")
+	var c Credential
+	username, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return Credential{}, fmt.Errorf("failed to read username: %w", err)
+	}
+	c.Username = strings.TrimSpace(username)
+	fmt.Print("Password: ")
+	password, err := term.ReadPassword(syscall.Stdin)
+	fmt.Println()
+	if err != nil {
+		return Credential{}, fmt.Errorf("failed to read password: %w", err)
+	}
+	c.Password = string(password)
+	return c, nil
+}
@@ -0,0 +1,236 @@
+package credentials
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/cdevr/cpush/agent"
+
+	"github.com/go-test/deep"
+)
+
+func TestEnv(t *testing.T) {
+	t.Setenv("TEST_CPUSH_PASSWORD", "s3cret")
+	t.Setenv("TEST_CPUSH_PASSWORD_USERNAME", "netops")
+	p, err := Open("env:TEST_CPUSH_PASSWORD")
+	if err != nil {
+		t.Fatalf("failed to open: %v", err)
+	}
+	got, err := p.Get(context.Background(), "anything")
+	if err != nil {
+		t.Fatalf("failed to get: %v", err)
+	}
+	if diff := deep.Equal(got, Credential{"netops", "s3cret"}); diff != nil {
+		t.Error(diff)
+	}
+
+	if _, err := Env("TEST_CPUSH_UNSET").Get(context.Background(), "anything"); err == nil {
+		t.Errorf("expected an error for an unset variable")
+	}
+}
+
+func TestCommand(t *testing.T) {
+	p, err := Open("cmd:cat testdata/%s")
+	if err != nil {
+		t.Fatalf("failed to open: %v", err)
+	}
+	for name, want := range map[string]Credential{
+		"core-admin": {"breakglass", "s3cret"},
+		"default":    {"", "hunter2"},
+	} {
+		got, err := p.Get(context.Background(), name)
+		if err != nil {
+			t.Errorf("failed to get %q: %v", name, err)
+			continue
+		}
+		if diff := deep.Equal(got, want); diff != nil {
+			t.Errorf("%s: %v", name, diff)
+		}
+	}
+	if _, err := p.Get(context.Background(), "missing"); err == nil {
+		t.Errorf("expected an error when the command fails")
+	}
+}
+
+func TestFile(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "credentials")
+	passphrase := func(pp string) func() (string, error) {
+		return func() (string, error) { return pp, nil }
+	}
+
+	f, err := OpenFile(fn, passphrase("master"))
+	if err != nil {
+		t.Fatalf("failed to open new file: %v", err)
+	}
+	if err := f.Set("default", Credential{Password: "hunter2"}); err != nil {
+		t.Fatalf("failed to set: %v", err)
+	}
+	if err := f.Set("core-admin", Credential{"breakglass", "s3cret"}); err != nil {
+		t.Fatalf("failed to set: %v", err)
+	}
+
+	f, err = OpenFile(fn, passphrase("master"))
+	if err != nil {
+		t.Fatalf("failed to reopen: %v", err)
+	}
+	got, err := f.Get(context.Background(), "core-admin")
+	if err != nil {
+		t.Fatalf("failed to get: %v", err)
+	}
+	if diff := deep.Equal(got, Credential{"breakglass", "s3cret"}); diff != nil {
+		t.Error(diff)
+	}
+	if _, err := f.Get(context.Background(), "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("got %v, want ErrNotFound", err)
+	}
+
+	if _, err := OpenFile(fn, passphrase("wrong")); err == nil {
+		t.Errorf("expected an error with the wrong passphrase")
+	}
+}
+
+func TestPerDevice(t *testing.T) {
+	store, err := Open("cmd:cat testdata/%s")
+	if err != nil {
+		t.Fatalf("failed to open: %v", err)
+	}
+	credentialOf := map[string]string{"rtr-1": "core-admin"}
+	p := &PerDevice{Provider: store, Lookup: func(device string) (string, string) {
+		return credentialOf[device], "netops"
+	}}
+
+	for device, want := range map[string]Credential{
+		"rtr-1": {"breakglass", "s3cret"},
+		"rtr-2": {"netops", "hunter2"},
+	} {
+		got, err := p.Get(context.Background(), device)
+		if err != nil {
+			t.Errorf("failed to get credential of %q: %v", device, err)
+			continue
+		}
+		if diff := deep.Equal(got, want); diff != nil {
+			t.Errorf("%s: %v", device, diff)
+		}
+	}
+}
+
+func TestOpenInvalid(t *testing.T) {
+	for _, spec := range []string{"", "env:", "vault:secret/x", "shm"} {
+		if _, err := Open(spec); err == nil {
+			t.Errorf("Open(%q): expected an error", spec)
+		}
+	}
+}
+
+func TestAgent(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "agent", "agent.sock")
+	l, err := agent.Listen(socket)
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	s := agent.NewServer(0, 0)
+	go s.Serve(l)
+	defer s.Stop()
+
+	var asked []string
+	newProvider := func() *Agent {
+		a := NewAgent(socket)
+		a.Ask = func(name string) (Credential, error) {
+			asked = append(asked, name)
+			return Credential{Password: "pw-" + name}, nil
+		}
+		return a
+	}
+
+	// The first run asks for the password and gives it to the agent, the next run gets it from the agent.
+	for run := 0; run < 2; run++ {
+		a := newProvider()
+		for i := 0; i < 2; i++ {
+			got, err := a.Get(context.Background(), DefaultName)
+			if err != nil {
+				t.Fatalf("failed to get: %v", err)
+			}
+			if got.Password != "pw-default" {
+				t.Errorf("got password %q, want %q", got.Password, "pw-default")
+			}
+		}
+	}
+	if diff := deep.Equal(asked, []string{DefaultName}); diff != nil {
+		t.Errorf("asked for: %v", diff)
+	}
+
+	// Without an agent, the password is still asked for.
+	asked = nil
+	s.Stop()
+	a := newProvider()
+	a.Client.Socket = filepath.Join(t.TempDir(), "missing.sock")
+	if _, err := a.Get(context.Background(), "core-admin"); err != nil {
+		t.Fatalf("failed to get without agent: %v", err)
+	}
+	if diff := deep.Equal(asked, []string{"core-admin"}); diff != nil {
+		t.Errorf("asked for: %v", diff)
+	}
+}
+
+func TestLogin(t *testing.T) {
+	store, err := Open("cmd:cat testdata/%s")
+	if err != nil {
+		t.Fatalf("failed to open: %v", err)
+	}
+	p := &PerDevice{Provider: store, Fallback: []string{"core-admin"}, Lookup: func(device string) (string, string) {
+		return "", "netops"
+	}}
+
+	// accepts returns a login function for a device that only accepts one password, and records what was tried.
+	var tried []string
+	accepts := func(password string) func(c Credential) error {
+		return func(c Credential) error {
+			tried = append(tried, c.Username)
+			if c.Password != password {
+				return fmt.Errorf("login: %w", ErrAuthFailed)
+			}
+			return nil
+		}
+	}
+
+	if err := Login(context.Background(), p, "rtr-1", accepts("hunter2")); err != nil {
+		t.Errorf("failed to log in with default: %v", err)
+	}
+	if err := Login(context.Background(), p, "rtr-2", accepts("s3cret")); err != nil {
+		t.Errorf("failed to log in with fallback: %v", err)
+	}
+	if err := Login(context.Background(), p, "rtr-3", accepts("other")); !errors.Is(err, ErrAuthFailed) {
+		t.Errorf("got %v, want ErrAuthFailed", err)
+	}
+	if diff := deep.Equal(tried, []string{"netops", "netops", "breakglass", "netops", "breakglass"}); diff != nil {
+		t.Errorf("tried: %v", diff)
+	}
+	for device, want := range map[string]string{"rtr-1": "default", "rtr-2": "core-admin", "rtr-3": ""} {
+		if got := p.LoggedInWith(device); got != want {
+			t.Errorf("%s logged in with %q, want %q", device, got, want)
+		}
+	}
+
+	// Errors other than authentication failures don't try the next credential.
+	tried = nil
+	err = Login(context.Background(), p, "rtr-4", func(c Credential) error {
+		tried = append(tried, c.Username)
+		return errors.New("connection refused")
+	})
+	if err == nil || errors.Is(err, ErrAuthFailed) || len(tried) != 1 {
+		t.Errorf("got %v after %d tries, want the connection error after 1 try", err, len(tried))
+	}
+}
+
+func TestCheckAuth(t *testing.T) {
+	err := CheckAuth(errors.New("ssh: handshake failed: ssh: unable to authenticate, attempted methods [none password], no supported methods remain"))
+	if !errors.Is(err, ErrAuthFailed) {
+		t.Errorf("got %v, want ErrAuthFailed", err)
+	}
+	if err := CheckAuth(errors.New("ssh: handshake failed: EOF")); errors.Is(err, ErrAuthFailed) {
+		t.Errorf("got %v, want no ErrAuthFailed", err)
+	}
+}
@@ -0,0 +1,67 @@
+package credentials
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrAuthFailed is wrapped by the errors of devices that refused a credential, as opposed to devices that couldn't be
+// reached. Trying again with the same credential is pointless.
+var ErrAuthFailed = errors.New("authentication failed")
+
+// CheckAuth wraps the error of an SSH handshake in ErrAuthFailed if the device refused the credential.
+func CheckAuth(err error) error {
+	if err != nil && strings.Contains(err.Error(), "unable to authenticate") {
+		return fmt.Errorf("%w: %v", ErrAuthFailed, err)
+	}
+	return err
+}
+
+// Chain is a provider with more than one credential per device, that are tried in order until the device accepts
+// one. For example a TACACS account, and a local break-glass account for when TACACS is down.
+type Chain interface {
+	Provider
+	// Names returns the names of the credentials of a device, in the order to try them.
+	Names(device string) []string
+	// GetNamed returns a credential of a device by its name.
+	GetNamed(ctx context.Context, device string, name string) (Credential, error)
+	// LoggedIn records that a device accepted a credential.
+	LoggedIn(device string, name string)
+}
+
+// Login logs in to a device with login, with the credential of the device from p. If p is a Chain, the credentials
+// are tried in order for as long as login returns an error that wraps ErrAuthFailed.
+func Login(ctx context.Context, p Provider, device string, login func(c Credential) error) error {
+	chain, ok := p.(Chain)
+	if !ok {
+		c, err := p.Get(ctx, device)
+		if err != nil {
+			return err
+		}
+		return login(c)
+	}
+
+	var refused []string
+	var err error
+	for _, name := range chain.Names(device) {
+		c, gerr := chain.GetNamed(ctx, device, name)
+		if gerr != nil {
+			return gerr
+		}
+		err = login(c)
+		if err == nil {
+			chain.LoggedIn(device, name)
+			return nil
+		}
+		if !errors.Is(err, ErrAuthFailed) {
+			return err
+		}
+		refused = append(refused, name)
+	}
+	if len(refused) > 1 {
+		return fmt.Errorf("device %q refused credentials %s, last error: %w", device, strings.Join(refused, ", "), err)
+	}
+	return err
+}
@@ -0,0 +1,164 @@
+package credentials
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+
+	"golang.org/x/crypto/scrypt"
+	"golang.org/x/term"
+	"gopkg.in/yaml.v3"
+)
+
+// PassphraseEnv is the environment variable with the master passphrase of credential files. If it's not set, the
+// passphrase is asked for.
+const PassphraseEnv = "CPUSH_MASTER_PASSPHRASE"
+
+// fileVersion is the format of credential files.
+const fileVersion = "cpush-credentials-v1"
+
+// encryptedFile is a credential file on disk. The data is a YAML map of names to credentials, encrypted with AES-GCM
+// with a key that is derived from the passphrase with scrypt.
+type encryptedFile struct {
+	Version string `json:"version"`
+	Salt    []byte `json:"salt"`
+	Nonce   []byte `json:"nonce"`
+	Data    []byte `json:"data"`
+}
+
+type fileCredential struct {
+	Username string `yaml:"username,omitempty"`
+	Password string `yaml:"password"`
+}
+
+// File is a provider with credentials from a file that is encrypted with a master passphrase. It's safe for concurrent
+// use.
+type File struct {
+	fn         string
+	passphrase string
+
+	mu          sync.Mutex
+	credentials map[string]fileCredential
+}
+
+// OpenFile decrypts a credential file. A file that doesn't exist yet has no credentials, until Set adds some. If
+// passphrase is nil, it's read from $CPUSH_MASTER_PASSPHRASE, or asked for.
+func OpenFile(fn string, passphrase func() (string, error)) (*File, error) {
+	if strings.HasPrefix(fn, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			fn = filepath.Join(home, fn[2:])
+		}
+	}
+	if passphrase == nil {
+		passphrase = askPassphrase
+	}
+	pp, err := passphrase()
+	if err != nil {
+		return nil, err
+	}
+	f := &File{fn: fn, passphrase: pp, credentials: map[string]fileCredential{}}
+
+	data, err := os.ReadFile(fn)
+	if errors.Is(err, os.ErrNotExist) {
+		return f, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read credential file %q: %v", fn, err)
+	}
+
+	var ef encryptedFile
+	if err := json.Unmarshal(data, &ef); err != nil || ef.Version != fileVersion {
+		return nil, fmt.Errorf("%q isn't a credential file", fn)
+	}
+	aead, err := newAEAD(pp, ef.Salt)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := aead.Open(nil, ef.Nonce, ef.Data, []byte(ef.Version))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt credential file %q, wrong passphrase?", fn)
+	}
+	if err := yaml.Unmarshal(plain, &f.credentials); err != nil {
+		return nil, fmt.Errorf("failed to parse credential file %q: %v", fn, err)
+	}
+	return f, nil
+}
+
+func askPassphrase() (string, error) {
+	if pp, ok := os.LookupEnv(PassphraseEnv); ok {
+		return pp, nil
+	}
+	fmt.Print("Please enter master passphrase: ")
+	pp, err := term.ReadPassword(syscall.Stdin)
+	fmt.Println()
+	if err != nil {
+		return "", fmt.Errorf("failed to read master passphrase: %w", err)
+	}
+	return string(pp), nil
+}
+
+// newAEAD derives the key from the passphrase.
+func newAEAD(passphrase string, salt []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key([]byte(passphrase), salt, 1<<15, 8, 1, 32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive key: %v", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func (f *File) Get(ctx context.Context, name string) (Credential, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	c, ok := f.credentials[name]
+	if !ok {
+		return Credential{}, fmt.Errorf("%w in %q: %q", ErrNotFound, f.fn, name)
+	}
+	return Credential{Username: c.Username, Password: c.Password}, nil
+}
+
+// Set adds or replaces a credential, and writes the file encrypted with a new salt.
+func (f *File) Set(name string, c Credential) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.credentials[name] = fileCredential{Username: c.Username, Password: c.Password}
+
+	plain, err := yaml.Marshal(f.credentials)
+	if err != nil {
+		return err
+	}
+	ef := encryptedFile{Version: fileVersion, Salt: make([]byte, 16)}
+	if _, err := rand.Read(ef.Salt); err != nil {
+		return err
+	}
+	aead, err := newAEAD(f.passphrase, ef.Salt)
+	if err != nil {
+		return err
+	}
+	ef.Nonce = make([]byte, aead.NonceSize())
+	if _, err := rand.Read(ef.Nonce); err != nil {
+		return err
+	}
+	ef.Data = aead.Seal(nil, ef.Nonce, plain, []byte(ef.Version))
+
+	data, err := json.Marshal(ef)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(f.fn, data, 0600); err != nil {
+		return fmt.Errorf("failed to write credential file %q: %v", f.fn, err)
+	}
+	return nil
+}
@@ -0,0 +1,375 @@
+// Package fleet executes a function against many devices in parallel, with retries and timeouts.
+//
+// Results are reported to observers, so the caller decides what to do with them. A progress indicator for the
+// terminal is available as an observer as well, see NewProgress.
+package fleet
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+// stopGrace is how long a try on a device is waited for after its context is done.
+var stopGrace = 10 * time.Second
+
+// ErrStillRunning is the error of a try on a device that didn't stop within a grace period after it was cancelled or
+// timed out. Such devices aren't tried again, since that would work on the device twice at the same time.
+var ErrStillRunning = errors.New("still running after being stopped")
+
+// DoFunc is the function that will be executed against many devices with retries, one at a time. It should stop
+// as soon as possible when the context is done.
+type DoFunc func(ctx context.Context, device string) (string, error)
+
+// Config configures how a Runner executes against devices.
+type Config struct {
+	// ConcurrentLimit is the maximum number of devices that are worked on simultaneously.
+	ConcurrentLimit int
+	// Retries is how many times a device is tried before it's considered failed.
+	Retries int
+	// Timeout is how long a single try on a device can take.
+	Timeout time.Duration
+	// Shuffle randomizes the order of the devices.
+	Shuffle bool
+	// MaxFailureRate halts the run when the fraction of finished devices that failed exceeds it: no new devices are
+	// started, the ones in progress are finished. Zero means never halt.
+	MaxFailureRate float64
+	// MinFinished is how many devices have to be finished before MaxFailureRate applies, so a single early failure
+	// doesn't halt the run. Zero means one.
+	MinFinished int
+
+	// Retryable is called with the error of a try on a device. Devices for which it returns false aren't tried again,
+	// like devices that refused the credential. Nil means every error is retried.
+	Retryable func(err error) bool
+	// Credential returns the name of the credential a device was logged in with, for the summary. Nil means the
+	// summary doesn't list credentials.
+	Credential func(device string) string
+
+	// Skip is called for every device before it's started. Devices for which it returns true are skipped.
+	Skip func(device string) bool
+	// Observers are notified of the progress and the results.
+	Observers []Observer
+}
+
+// Result is the outcome of executing on a single device.
+type Result struct {
+	Device   string
+	Output   string
+	Err      error
+	Attempts int
+}
+
+// Summary lists which devices succeeded, failed or were skipped. Devices that were never started because the run was
+// cancelled or halted are not attempted.
+type Summary struct {
+	Succeeded    []string
+	Failed       []string
+	Skipped      []string
+	NotAttempted []string
+	Errors       map[string]error
+	// Credentials are the names of the credentials that the devices that succeeded were logged in with, if
+	// Config.Credential is set.
+	Credentials map[string]string
+	// Halted is true if the run was halted because too many devices failed.
+	Halted bool
+}
+
+// FailureRate returns the fraction of finished devices that failed.
+func (s Summary) FailureRate() float64 {
+	finished := len(s.Succeeded) + len(s.Failed)
+	if finished == 0 {
+		return 0
+	}
+	return float64(len(s.Failed)) / float64(finished)
+}
+
+// TooManyFailed returns true if the fraction of finished devices that failed exceeds maxRate, once at least
+// minFinished devices finished. A maxRate of zero is never exceeded.
+func (s Summary) TooManyFailed(maxRate float64, minFinished int) bool {
+	if maxRate <= 0 || len(s.Succeeded)+len(s.Failed) < minFinished {
+		return false
+	}
+	return s.FailureRate() > maxRate
+}
+
+// Add adds the devices of another summary to this one.
+func (s *Summary) Add(other Summary) {
+	s.Succeeded = append(s.Succeeded, other.Succeeded...)
+	s.Failed = append(s.Failed, other.Failed...)
+	s.Skipped = append(s.Skipped, other.Skipped...)
+	s.NotAttempted = append(s.NotAttempted, other.NotAttempted...)
+	if s.Errors == nil {
+		s.Errors = map[string]error{}
+	}
+	for d, err := range other.Errors {
+		s.Errors[d] = err
+	}
+	for d, c := range other.Credentials {
+		if s.Credentials == nil {
+			s.Credentials = map[string]string{}
+		}
+		s.Credentials[d] = c
+	}
+	s.Halted = s.Halted || other.Halted
+	sort.Strings(s.Succeeded)
+	sort.Strings(s.Failed)
+	sort.Strings(s.Skipped)
+	sort.Strings(s.NotAttempted)
+}
+
+// Observer is notified about the progress of a run. All methods are called from the goroutine that called Run, one
+// at a time, so implementations don't need locking.
+type Observer interface {
+	// Begin is called once with all devices before anything is executed.
+	Begin(devices []string)
+	Skipped(device string)
+	Started(device string)
+	Retrying(device string, attempt int, err error)
+	// Finished is called once per device that was started, with the final result.
+	Finished(result Result)
+	// End is called once when all devices are done.
+	End(summary Summary)
+}
+
+// ResultFunc is an observer that only cares about the results.
+type ResultFunc func(result Result)
+
+func (f ResultFunc) Begin(devices []string)                         {}
+func (f ResultFunc) Skipped(device string)                          {}
+func (f ResultFunc) Started(device string)                          {}
+func (f ResultFunc) Retrying(device string, attempt int, err error) {}
+func (f ResultFunc) Finished(result Result)                         { f(result) }
+func (f ResultFunc) End(summary Summary)                            {}
+
+// Runner executes a function against many devices.
+type Runner struct {
+	cfg Config
+}
+
+// NewRunner creates a runner with the given configuration.
+func NewRunner(cfg Config) *Runner {
+	if cfg.ConcurrentLimit < 1 {
+		cfg.ConcurrentLimit = 1
+	}
+	if cfg.Retries < 1 {
+		cfg.Retries = 1
+	}
+	return &Runner{cfg}
+}
+
+// startEvent asks the event loop whether a device may be started, the answer is sent on ok.
+type startEvent struct {
+	device string
+	ok     chan bool
+}
+
+type retryEvent struct {
+	device  string
+	attempt int
+	err     error
+}
+
+// Run executes do on all devices, and reports to the observers. When the context is cancelled, no new devices or
+// retries are started. When the run is halted because of MaxFailureRate, no new devices are started.
+func (r *Runner) Run(ctx context.Context, devices []string, do DoFunc) Summary {
+	var wg sync.WaitGroup
+
+	deviceChan := make(chan string)
+	halt := make(chan struct{})
+
+	results := make(chan Result)
+	start := make(chan startEvent)
+	retry := make(chan retryEvent)
+	skipped := make(chan string)
+
+	done := make(chan bool)
+
+	summary := Summary{Errors: map[string]error{}}
+
+	doDevice := func(device string) (string, error) {
+		ctx, cancel := context.WithTimeout(ctx, r.cfg.Timeout)
+		defer cancel()
+
+		type result struct {
+			output string
+			err    error
+		}
+		done := make(chan result, 1)
+		go func() {
+			output, err := do(ctx, device)
+			done <- result{output, err}
+		}()
+
+		select {
+		case r := <-done:
+			return r.output, r.err
+		case <-ctx.Done():
+		}
+
+		// Wait for do to stop, so a retry doesn't work on the device at the same time.
+		var err error
+		select {
+		case r := <-done:
+			if r.err == nil {
+				return r.output, nil
+			}
+			err = r.err
+		case <-time.After(stopGrace):
+			err = ErrStillRunning
+		}
+		if ctx.Err() == context.DeadlineExceeded {
+			return "", fmt.Errorf("router %q hit timeout after %v: %w", device, r.cfg.Timeout, err)
+		}
+		return "", fmt.Errorf("router %q aborted: %w", device, err)
+	}
+
+	worker := func() {
+		defer wg.Done()
+		ok := make(chan bool)
+		for device := range deviceChan {
+			// The run might have been halted or cancelled after this device was handed to the worker.
+			start <- startEvent{device, ok}
+			if !<-ok {
+				continue
+			}
+
+			result := Result{Device: device}
+			for result.Attempts < r.cfg.Retries {
+				result.Attempts += 1
+				result.Output, result.Err = doDevice(device)
+				if result.Err == nil || ctx.Err() != nil {
+					break
+				}
+				if errors.Is(result.Err, ErrStillRunning) || (r.cfg.Retryable != nil && !r.cfg.Retryable(result.Err)) {
+					break
+				}
+				if result.Attempts < r.cfg.Retries {
+					retry <- retryEvent{device, result.Attempts, result.Err}
+				}
+			}
+			if result.Err != nil {
+				result.Err = fmt.Errorf("failed in %d tries, last error: %w", result.Attempts, result.Err)
+			}
+			results <- result
+		}
+	}
+
+	for i := 0; i < r.cfg.ConcurrentLimit; i++ {
+		wg.Add(1)
+		go worker()
+	}
+
+	// Shuffle devices to do them in random order if requested.
+	if r.cfg.Shuffle {
+		devices = append([]string{}, devices...)
+		rand.Shuffle(len(devices), func(i, j int) { devices[i], devices[j] = devices[j], devices[i] })
+	}
+
+	for _, o := range r.cfg.Observers {
+		o.Begin(devices)
+	}
+
+	go func() {
+		defer close(deviceChan)
+
+		// Skip all the devices we're going to skip.
+		var dontSkip []string
+		for _, d := range devices {
+			if r.cfg.Skip != nil && r.cfg.Skip(d) {
+				skipped <- d
+				continue
+			}
+			dontSkip = append(dontSkip, d)
+		}
+
+		// Then execute the remainder.
+		for _, d := range dontSkip {
+			select {
+			case deviceChan <- d:
+			case <-ctx.Done():
+				return
+			case <-halt:
+				return
+			}
+		}
+	}()
+
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	allDone := false
+	for !allDone {
+		select {
+		case d := <-skipped:
+			summary.Skipped = append(summary.Skipped, d)
+			for _, o := range r.cfg.Observers {
+				o.Skipped(d)
+			}
+		case se := <-start:
+			if summary.Halted || ctx.Err() != nil {
+				se.ok <- false
+				continue
+			}
+			for _, o := range r.cfg.Observers {
+				o.Started(se.device)
+			}
+			se.ok <- true
+		case re := <-retry:
+			for _, o := range r.cfg.Observers {
+				o.Retrying(re.device, re.attempt, re.err)
+			}
+		case result := <-results:
+			if result.Err != nil {
+				summary.Failed = append(summary.Failed, result.Device)
+				summary.Errors[result.Device] = result.Err
+			} else {
+				summary.Succeeded = append(summary.Succeeded, result.Device)
+				if r.cfg.Credential != nil {
+					if c := r.cfg.Credential(result.Device); c != "" {
+						if summary.Credentials == nil {
+							summary.Credentials = map[string]string{}
+						}
+						summary.Credentials[result.Device] = c
+					}
+				}
+			}
+			for _, o := range r.cfg.Observers {
+				o.Finished(result)
+			}
+			if !summary.Halted && summary.TooManyFailed(r.cfg.MaxFailureRate, r.cfg.MinFinished) {
+				summary.Halted = true
+				close(halt)
+			}
+		case <-done:
+			allDone = true
+		}
+	}
+
+	finished := map[string]bool{}
+	for _, list := range [][]string{summary.Succeeded, summary.Failed, summary.Skipped} {
+		for _, d := range list {
+			finished[d] = true
+		}
+	}
+	for _, d := range devices {
+		if !finished[d] {
+			summary.NotAttempted = append(summary.NotAttempted, d)
+		}
+	}
+
+	sort.Strings(summary.Succeeded)
+	sort.Strings(summary.Failed)
+	sort.Strings(summary.Skipped)
+	sort.Strings(summary.NotAttempted)
+
+	for _, o := range r.cfg.Observers {
+		o.End(summary)
+	}
+	return summary
+}
@@ -0,0 +1,263 @@
+package fleet
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+)
+
+func TestRun(t *testing.T) {
+	var m sync.Mutex
+	tries := map[string]int{}
+	outputs := map[string]string{}
+
+	do := func(ctx context.Context, device string) (string, error) {
+		m.Lock()
+		tries[device] += 1
+		try := tries[device]
+		m.Unlock()
+
+		switch device {
+		case "flaky":
+			if try < 2 {
+				return "", fmt.Errorf("flaky failure")
+			}
+		case "broken":
+			return "", fmt.Errorf("broken")
+		case "hung":
+			<-ctx.Done()
+			return "", ctx.Err()
+		}
+		return "output of " + device, nil
+	}
+
+	var progress bytes.Buffer
+	runner := NewRunner(Config{
+		ConcurrentLimit: 2,
+		Retries:         3,
+		Timeout:         100 * time.Millisecond,
+		Skip:            func(device string) bool { return device == "done" },
+		Observers: []Observer{
+			ResultFunc(func(result Result) {
+				if result.Err == nil {
+					outputs[result.Device] = result.Output
+				}
+			}),
+			NewProgress(&progress, false),
+		},
+	})
+
+	summary := runner.Run(context.Background(), []string{"good", "flaky", "broken", "hung", "done"}, do)
+
+	if diff := deep.Equal(summary.Succeeded, []string{"flaky", "good"}); diff != nil {
+		t.Errorf("succeeded: %v", diff)
+	}
+	if diff := deep.Equal(summary.Failed, []string{"broken", "hung"}); diff != nil {
+		t.Errorf("failed: %v", diff)
+	}
+	if diff := deep.Equal(summary.Skipped, []string{"done"}); diff != nil {
+		t.Errorf("skipped: %v", diff)
+	}
+	if diff := deep.Equal(outputs, map[string]string{"good": "output of good", "flaky": "output of flaky"}); diff != nil {
+		t.Errorf("outputs: %v", diff)
+	}
+
+	m.Lock()
+	defer m.Unlock()
+	if tries["broken"] != 3 {
+		t.Errorf("expected 3 tries on a broken device, got %d", tries["broken"])
+	}
+	if tries["done"] != 0 {
+		t.Errorf("skipped device was tried %d times", tries["done"])
+	}
+
+	if !strings.Contains(progress.String(), `error on "broken"`) {
+		t.Errorf("expected the progress observer to report the error on broken, got %q", progress.String())
+	}
+}
+
+func TestRunCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var m sync.Mutex
+	started := 0
+
+	do := func(ctx context.Context, device string) (string, error) {
+		m.Lock()
+		started += 1
+		m.Unlock()
+
+		// The first device cancels the whole run.
+		cancel()
+		<-ctx.Done()
+		return "", ctx.Err()
+	}
+
+	runner := NewRunner(Config{ConcurrentLimit: 1, Retries: 3, Timeout: time.Second})
+	summary := runner.Run(ctx, []string{"rtr1", "rtr2", "rtr3"}, do)
+
+	m.Lock()
+	defer m.Unlock()
+	if started != 1 {
+		t.Errorf("expected no retries or new devices after cancellation, but %d tries were started", started)
+	}
+	if diff := deep.Equal(summary.Failed, []string{"rtr1"}); diff != nil {
+		t.Errorf("failed: %v", diff)
+	}
+	if diff := deep.Equal(summary.NotAttempted, []string{"rtr2", "rtr3"}); diff != nil {
+		t.Errorf("not attempted: %v", diff)
+	}
+}
+
+func TestRunHalts(t *testing.T) {
+	var devices []string
+	for i := 0; i < 10; i++ {
+		devices = append(devices, fmt.Sprintf("rtr%d", i))
+	}
+
+	r := NewRunner(Config{ConcurrentLimit: 1, Retries: 1, Timeout: time.Second, MaxFailureRate: 0.5})
+	summary := r.Run(context.Background(), devices, func(ctx context.Context, device string) (string, error) {
+		return "", fmt.Errorf("broken")
+	})
+
+	if !summary.Halted {
+		t.Errorf("run wasn't halted")
+	}
+	if len(summary.Failed) != 1 || len(summary.NotAttempted) != 9 {
+		t.Errorf("got %d failed and %d not attempted, want 1 and 9", len(summary.Failed), len(summary.NotAttempted))
+	}
+}
+
+func TestRunHaltsAfterMinFinished(t *testing.T) {
+	var devices []string
+	for i := 0; i < 10; i++ {
+		devices = append(devices, fmt.Sprintf("rtr%d", i))
+	}
+
+	// The first device fails, but that's only 1 in 5 once enough devices finished.
+	r := NewRunner(Config{ConcurrentLimit: 1, Retries: 1, Timeout: time.Second, MaxFailureRate: 0.2, MinFinished: 5})
+	summary := r.Run(context.Background(), devices, func(ctx context.Context, device string) (string, error) {
+		if device == "rtr0" {
+			return "", fmt.Errorf("broken")
+		}
+		return "", nil
+	})
+
+	if summary.Halted {
+		t.Errorf("run was halted after the first failure")
+	}
+	if len(summary.Succeeded) != 9 {
+		t.Errorf("got %d succeeded, want 9", len(summary.Succeeded))
+	}
+}
+
+func TestRunNotRetryable(t *testing.T) {
+	errRefused := errors.New("refused")
+	var m sync.Mutex
+	tries := map[string]int{}
+	do := func(ctx context.Context, device string) (string, error) {
+		m.Lock()
+		defer m.Unlock()
+		tries[device] += 1
+		switch device {
+		case "unreachable":
+			return "", fmt.Errorf("unreachable")
+		case "refusing":
+			return "", fmt.Errorf("login: %w", errRefused)
+		}
+		return "", nil
+	}
+
+	runner := NewRunner(Config{
+		ConcurrentLimit: 2,
+		Retries:         3,
+		Timeout:         time.Second,
+		Retryable:       func(err error) bool { return !errors.Is(err, errRefused) },
+		Credential: func(device string) string {
+			if device == "tacacs-down" {
+				return "breakglass"
+			}
+			return "default"
+		},
+	})
+	summary := runner.Run(context.Background(), []string{"good", "tacacs-down", "unreachable", "refusing"}, do)
+
+	if diff := deep.Equal(tries, map[string]int{"good": 1, "tacacs-down": 1, "unreachable": 3, "refusing": 1}); diff != nil {
+		t.Errorf("tries: %v", diff)
+	}
+	if diff := deep.Equal(summary.Credentials, map[string]string{"good": "default", "tacacs-down": "breakglass"}); diff != nil {
+		t.Errorf("credentials: %v", diff)
+	}
+
+	var out bytes.Buffer
+	PrintSummary(&out, summary)
+	if !strings.Contains(out.String(), `Logged in with credential "breakglass" (1 devices)`) {
+		t.Errorf("expected the summary to list the credentials, got %q", out.String())
+	}
+}
+
+func TestRunWaitsForTimedOutTry(t *testing.T) {
+	var m sync.Mutex
+	running, tries := 0, map[string]int{}
+	// finished is done when all tries returned, including the stuck one that outlives the run.
+	var finished sync.WaitGroup
+	do := func(ctx context.Context, device string) (string, error) {
+		finished.Add(1)
+		defer finished.Done()
+		m.Lock()
+		running += 1
+		tries[device] += 1
+		if running > 1 {
+			t.Errorf("%d tries on %s at the same time", running, device)
+		}
+		m.Unlock()
+
+		<-ctx.Done()
+		if device == "stuck" {
+			// Cleaning up takes longer than the grace period. It doesn't touch anything the run does once the run gave
+			// up on it, so the race detector notices when the run shares this try's result.
+			m.Lock()
+			running -= 1
+			m.Unlock()
+			time.Sleep(200 * time.Millisecond)
+			return "", context.DeadlineExceeded
+		}
+		// Cleaning up takes a while, but less than the grace period.
+		time.Sleep(50 * time.Millisecond)
+		m.Lock()
+		running -= 1
+		m.Unlock()
+		return "", ctx.Err()
+	}
+
+	defer func(grace time.Duration) { stopGrace = grace }(stopGrace)
+	stopGrace = 100 * time.Millisecond
+	// stuck is last, since it's still running when the run is done.
+	for _, test := range []struct {
+		device string
+		tries  int
+		err    error
+	}{
+		{"slow", 3, context.DeadlineExceeded},
+		{"stuck", 1, ErrStillRunning},
+	} {
+		summary := NewRunner(Config{Retries: 3, Timeout: 10 * time.Millisecond}).Run(context.Background(), []string{test.device}, do)
+		if err := summary.Errors[test.device]; !errors.Is(err, test.err) {
+			t.Errorf("%s: got error %v, want %v", test.device, err, test.err)
+		}
+		m.Lock()
+		if tries[test.device] != test.tries {
+			t.Errorf("%s: got %d tries, want %d", test.device, tries[test.device], test.tries)
+		}
+		m.Unlock()
+	}
+	// Let the stuck try finish, so the race detector sees what it does after the run gave up on it.
+	finished.Wait()
+}
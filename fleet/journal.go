@@ -0,0 +1,166 @@
+package fleet
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// DeviceState is the state of a device in a run.
+type DeviceState string
+
+const (
+	Pending   DeviceState = "pending"
+	Running   DeviceState = "running"
+	Succeeded DeviceState = "succeeded"
+	Failed    DeviceState = "failed"
+	Skipped   DeviceState = "skipped"
+)
+
+// JournalRecord is a single line in a journal. Records without a device start a run, and describe the operation.
+type JournalRecord struct {
+	Time      time.Time   `json:"time"`
+	Operation string      `json:"operation,omitempty"`
+	Device    string      `json:"device,omitempty"`
+	State     DeviceState `json:"state,omitempty"`
+	Attempts  int         `json:"attempts,omitempty"`
+	Error     string      `json:"error,omitempty"`
+}
+
+// Journal is an observer that records every state change of the devices in a run to a file, one JSON record per
+// line. Because the file is only appended to, it survives cpush being killed, and it can be used to resume the run.
+type Journal struct {
+	f   *os.File
+	enc *json.Encoder
+}
+
+// OpenJournal opens a journal for appending, and records the start of a run of the operation.
+func OpenJournal(fn string, operation string) (*Journal, error) {
+	f, err := os.OpenFile(fn, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open journal %q: %v", fn, err)
+	}
+	j := &Journal{f, json.NewEncoder(f)}
+	if err := j.enc.Encode(JournalRecord{Time: time.Now(), Operation: operation}); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to write to journal %q: %v", fn, err)
+	}
+	return j, nil
+}
+
+// Close closes the journal file.
+func (j *Journal) Close() error {
+	return j.f.Close()
+}
+
+func (j *Journal) record(device string, state DeviceState, attempts int, err error) {
+	r := JournalRecord{Time: time.Now(), Device: device, State: state, Attempts: attempts}
+	if err != nil {
+		r.Error = err.Error()
+	}
+	if err := j.enc.Encode(r); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to write to journal %q: %v\n", j.f.Name(), err)
+	}
+}
+
+func (j *Journal) Begin(devices []string) {
+	for _, d := range devices {
+		j.record(d, Pending, 0, nil)
+	}
+}
+
+func (j *Journal) Skipped(device string) {
+	j.record(device, Skipped, 0, nil)
+}
+
+func (j *Journal) Started(device string) {
+	j.record(device, Running, 0, nil)
+}
+
+func (j *Journal) Retrying(device string, attempt int, err error) {
+	j.record(device, Running, attempt, err)
+}
+
+func (j *Journal) Finished(result Result) {
+	state := Succeeded
+	if result.Err != nil {
+		state = Failed
+	}
+	j.record(result.Device, state, result.Attempts, result.Err)
+}
+
+func (j *Journal) End(summary Summary) {
+	j.f.Sync()
+}
+
+// JournalState is the last known state of every device in a journal.
+type JournalState struct {
+	// Operation is the operation of the last run in the journal.
+	Operation string
+	// Devices lists the devices in the order they first appear in the journal.
+	Devices []string
+	// Last contains the last record of every device.
+	Last map[string]JournalRecord
+}
+
+// LoadJournal reads a journal. A truncated last line, from a process that was killed while writing, is ignored.
+func LoadJournal(fn string) (*JournalState, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open journal %q: %v", fn, err)
+	}
+	defer f.Close()
+
+	state := &JournalState{Last: map[string]JournalRecord{}}
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var r JournalRecord
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			continue
+		}
+		if r.Device == "" {
+			state.Operation = r.Operation
+			continue
+		}
+		if _, ok := state.Last[r.Device]; !ok {
+			state.Devices = append(state.Devices, r.Device)
+		}
+		state.Last[r.Device] = r
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read journal %q: %v", fn, err)
+	}
+	return state, nil
+}
+
+// Remaining returns the devices that still need to be done: the ones that are pending or failed. Devices that were
+// running when the run was interrupted are only included if includeRunning is true, because the operation may or may
+// not have been applied to them.
+func (s *JournalState) Remaining(includeRunning bool) []string {
+	var result []string
+	for _, d := range s.Devices {
+		switch s.Last[d].State {
+		case Pending, Failed:
+			result = append(result, d)
+		case Running:
+			if includeRunning {
+				result = append(result, d)
+			}
+		}
+	}
+	return result
+}
+
+// InState returns the devices whose last state is the given state.
+func (s *JournalState) InState(state DeviceState) []string {
+	var result []string
+	for _, d := range s.Devices {
+		if s.Last[d].State == state {
+			result = append(result, d)
+		}
+	}
+	return result
+}
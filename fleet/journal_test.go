@@ -0,0 +1,84 @@
+package fleet
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+)
+
+func TestJournal(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "journal.jsonl")
+
+	j, err := OpenJournal(fn, "cmd show version")
+	if err != nil {
+		t.Fatalf("failed to open journal: %v", err)
+	}
+	r := NewRunner(Config{ConcurrentLimit: 2, Retries: 2, Timeout: time.Second, Observers: []Observer{j}})
+	r.Run(context.Background(), []string{"ok", "broken"}, func(ctx context.Context, device string) (string, error) {
+		if device == "broken" {
+			return "", fmt.Errorf("broken")
+		}
+		return "", nil
+	})
+	j.Close()
+
+	state, err := LoadJournal(fn)
+	if err != nil {
+		t.Fatalf("failed to load journal: %v", err)
+	}
+	if state.Operation != "cmd show version" {
+		t.Errorf("got operation %q, want %q", state.Operation, "cmd show version")
+	}
+	if got, want := state.Last["ok"].State, Succeeded; got != want {
+		t.Errorf("got state %q for ok, want %q", got, want)
+	}
+	broken := state.Last["broken"]
+	if broken.State != Failed || broken.Attempts != 2 || broken.Error == "" {
+		t.Errorf("got %+v for broken, want failed after 2 attempts with an error", broken)
+	}
+	if diff := deep.Equal(state.Remaining(false), []string{"broken"}); diff != nil {
+		t.Errorf("unexpected remaining devices: %v", diff)
+	}
+}
+
+func TestJournalInterrupted(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "journal.jsonl")
+
+	j, err := OpenJournal(fn, "push sha256:abc")
+	if err != nil {
+		t.Fatalf("failed to open journal: %v", err)
+	}
+	j.Begin([]string{"done", "inprogress", "notstarted", "skipped"})
+	j.Started("done")
+	j.Finished(Result{Device: "done", Attempts: 1})
+	j.Skipped("skipped")
+	j.Started("inprogress")
+	j.Close()
+
+	// Simulate being killed halfway through writing a record.
+	f, err := os.OpenFile(fn, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatalf("failed to reopen journal: %v", err)
+	}
+	f.WriteString(`{"time":"2022-01-01T00:00:00Z","device":"notst`)
+	f.Close()
+
+	state, err := LoadJournal(fn)
+	if err != nil {
+		t.Fatalf("failed to load journal: %v", err)
+	}
+	if diff := deep.Equal(state.Remaining(false), []string{"notstarted"}); diff != nil {
+		t.Errorf("unexpected remaining devices: %v", diff)
+	}
+	if diff := deep.Equal(state.Remaining(true), []string{"inprogress", "notstarted"}); diff != nil {
+		t.Errorf("unexpected remaining devices including running: %v", diff)
+	}
+	if diff := deep.Equal(state.InState(Running), []string{"inprogress"}); diff != nil {
+		t.Errorf("unexpected running devices: %v", diff)
+	}
+}
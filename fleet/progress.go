@@ -0,0 +1,138 @@
+package fleet
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/cdevr/cpush/texttable"
+)
+
+// ClearLine is the ANSI code to erase the current line and put the cursor at the beginning of the line.
+const ClearLine = "\033[2K\r"
+
+// Progress is an observer that shows a progress indicator on a terminal, along with retries and errors.
+type Progress struct {
+	w        io.Writer
+	showLine bool
+
+	startTime time.Time
+	total     int
+
+	skippedCount int
+	startedCount int
+	endedCount   int
+}
+
+// NewProgress creates a progress indicator that writes to w, usually os.Stderr. If showLine is false, only retries
+// and errors are shown.
+func NewProgress(w io.Writer, showLine bool) *Progress {
+	return &Progress{w: w, showLine: showLine}
+}
+
+func (p *Progress) line() string {
+	inProgress := p.startedCount - p.endedCount
+	remaining := p.total - inProgress - p.endedCount - p.skippedCount
+	progress := float64(p.endedCount) / float64(p.total-p.skippedCount)
+
+	timeElapsed := time.Since(p.startTime).Round(time.Second)
+	expectedDuration := time.Duration(float64(timeElapsed) / progress).Round(time.Second)
+
+	expectedFinish := time.Now().Add(expectedDuration).Round(time.Second)
+
+	expectedDurationStr := expectedDuration.String()
+	expectedFinishStr := expectedFinish.String()
+	if timeElapsed < 2*time.Second || p.endedCount < 1 {
+		timeElapsed = 0
+		expectedDurationStr = "..."
+		expectedFinishStr = "..."
+	}
+
+	return fmt.Sprintf("%d/%d/%d/%d %2.2f%% %s/%s expected finish @ %v", remaining, inProgress, p.endedCount+p.skippedCount, p.total, 100.0*progress, timeElapsed, expectedDurationStr, expectedFinishStr)
+}
+
+func (p *Progress) redraw() {
+	if p.showLine {
+		fmt.Fprint(p.w, ClearLine+p.line())
+	}
+}
+
+// Begin starts counting anew, since a progress indicator is used for every wave of a run.
+func (p *Progress) Begin(devices []string) {
+	p.startTime = time.Now()
+	p.total = len(devices)
+	p.skippedCount = 0
+	p.startedCount = 0
+	p.endedCount = 0
+}
+
+func (p *Progress) Skipped(device string) {
+	p.skippedCount += 1
+}
+
+func (p *Progress) Started(device string) {
+	p.startedCount += 1
+	p.redraw()
+}
+
+func (p *Progress) Retrying(device string, attempt int, err error) {
+	fmt.Fprintf(p.w, ClearLine+"Retrying %q after attempt %d: %v\n", device, attempt, err)
+	p.redraw()
+}
+
+func (p *Progress) Finished(result Result) {
+	p.endedCount += 1
+	if result.Err != nil {
+		fmt.Fprintf(p.w, ClearLine+"error on %q: %v\n", result.Device, result.Err)
+	}
+	p.redraw()
+}
+
+func (p *Progress) End(summary Summary) {
+	if p.showLine {
+		p.redraw()
+		fmt.Fprintf(p.w, "\n")
+	}
+}
+
+// printDevices prints a heading with a list of devices in columns.
+func printDevices(w io.Writer, heading string, devices []string) {
+	fmt.Fprintf(w, "%s (%d devices)\n\n", heading, len(devices))
+
+	if len(devices) == 0 {
+		fmt.Fprintln(w, "(None)")
+	} else {
+		fmt.Fprintln(w, texttable.Columns(devices, 4))
+	}
+	fmt.Fprintf(w, "\n")
+}
+
+// PrintSummary will print an overview of succeeded and failed devices.
+func PrintSummary(w io.Writer, summary Summary) {
+	fmt.Fprintln(w)
+	printDevices(w, "Succeeded", summary.Succeeded)
+	printDevices(w, "Failed", summary.Failed)
+	if len(summary.Skipped) > 0 {
+		printDevices(w, "Skipped", summary.Skipped)
+	}
+	if len(summary.NotAttempted) > 0 {
+		printDevices(w, "Not attempted", summary.NotAttempted)
+	}
+
+	byCredential := map[string][]string{}
+	for d, c := range summary.Credentials {
+		byCredential[c] = append(byCredential[c], d)
+	}
+	if len(byCredential) > 0 {
+		var names []string
+		for c := range byCredential {
+			names = append(names, c)
+		}
+		sort.Strings(names)
+		for _, c := range names {
+			sort.Strings(byCredential[c])
+			printDevices(w, fmt.Sprintf("Logged in with credential %q", c), byCredential[c])
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package fleet
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProgressWaves(t *testing.T) {
+	p := NewProgress(&bytes.Buffer{}, false)
+	runner := NewRunner(Config{
+		Timeout:   time.Second,
+		Skip:      func(device string) bool { return device == "done" },
+		Observers: []Observer{p},
+	})
+	do := func(ctx context.Context, device string) (string, error) {
+		return "", nil
+	}
+
+	for _, wave := range [][]string{{"canary", "done"}, {"rtr1", "rtr2", "rtr3"}} {
+		runner.Run(context.Background(), wave, do)
+	}
+	// The second wave is counted on its own: nothing remaining or in progress, 3 out of 3 devices done.
+	if got, want := p.line(), "0/0/3/3 100.00%"; !strings.HasPrefix(got, want) {
+		t.Errorf("got progress %q after the second wave, want it to start with %q", got, want)
+	}
+}
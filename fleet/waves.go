@@ -0,0 +1,56 @@
+package fleet
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ParseWaveSize parses a wave size, either a number of devices like "20" or a percentage of total like "10%". The
+// result is at least 1.
+func ParseWaveSize(s string, total int) (int, error) {
+	var size int
+	if pct := strings.TrimSuffix(s, "%"); pct != s {
+		f, err := strconv.ParseFloat(pct, 64)
+		if err != nil || f <= 0 || f > 100 {
+			return 0, fmt.Errorf("invalid wave percentage %q", s)
+		}
+		size = int(math.Ceil(f * float64(total) / 100))
+	} else {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("invalid wave size %q", s)
+		}
+		size = n
+	}
+	if size < 1 {
+		size = 1
+	}
+	return size, nil
+}
+
+// Waves splits devices into a canary wave of canary devices, followed by waves of size devices. A canary of zero
+// means there's no canary wave, a size of zero means the remainder is done in one wave.
+func Waves(devices []string, canary int, size int) [][]string {
+	var waves [][]string
+	if canary > 0 {
+		if canary > len(devices) {
+			canary = len(devices)
+		}
+		waves = append(waves, devices[:canary])
+		devices = devices[canary:]
+	}
+	if size <= 0 {
+		size = len(devices)
+	}
+	for len(devices) > 0 {
+		n := size
+		if n > len(devices) {
+			n = len(devices)
+		}
+		waves = append(waves, devices[:n])
+		devices = devices[n:]
+	}
+	return waves
+}
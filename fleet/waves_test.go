@@ -0,0 +1,51 @@
+package fleet
+
+import (
+	"testing"
+
+	"github.com/go-test/deep"
+)
+
+func TestParseWaveSize(t *testing.T) {
+	for _, tc := range []struct {
+		s     string
+		total int
+		want  int
+		err   bool
+	}{
+		{"20", 100, 20, false},
+		{"10%", 100, 10, false},
+		{"10%", 5, 1, false},
+		{"33%", 10, 4, false},
+		{"0", 10, 0, true},
+		{"150%", 10, 0, true},
+		{"many", 10, 0, true},
+	} {
+		got, err := ParseWaveSize(tc.s, tc.total)
+		if (err != nil) != tc.err {
+			t.Errorf("ParseWaveSize(%q, %d) got error %v, want error %v", tc.s, tc.total, err, tc.err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("ParseWaveSize(%q, %d) = %d, want %d", tc.s, tc.total, got, tc.want)
+		}
+	}
+}
+
+func TestWaves(t *testing.T) {
+	devices := []string{"a", "b", "c", "d", "e", "f"}
+	for _, tc := range []struct {
+		canary, size int
+		want         [][]string
+	}{
+		{0, 0, [][]string{{"a", "b", "c", "d", "e", "f"}}},
+		{1, 0, [][]string{{"a"}, {"b", "c", "d", "e", "f"}}},
+		{1, 2, [][]string{{"a"}, {"b", "c"}, {"d", "e"}, {"f"}}},
+		{0, 4, [][]string{{"a", "b", "c", "d"}, {"e", "f"}}},
+		{10, 2, [][]string{{"a", "b", "c", "d", "e", "f"}}},
+	} {
+		if diff := deep.Equal(Waves(devices, tc.canary, tc.size), tc.want); diff != nil {
+			t.Errorf("Waves(canary %d, size %d): %v", tc.canary, tc.size, diff)
+		}
+	}
+}
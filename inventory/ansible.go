@@ -0,0 +1,366 @@
+package inventory
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ansibleGroup is a group in an Ansible inventory.
+type ansibleGroup struct {
+	vars     map[string]string
+	children []string
+	// hosts maps the hosts in the group to their variables.
+	hosts map[string]map[string]string
+}
+
+// ansibleInventory maps group names to groups. Every inventory has the groups "all" and "ungrouped".
+type ansibleInventory map[string]*ansibleGroup
+
+func (a ansibleInventory) group(name string) *ansibleGroup {
+	g, ok := a[name]
+	if !ok {
+		g = &ansibleGroup{vars: map[string]string{}, hosts: map[string]map[string]string{}}
+		a[name] = g
+	}
+	return g
+}
+
+// LoadAnsible reads an Ansible inventory in INI or YAML format. The connection variables ansible_host, ansible_port,
+// ansible_user and ansible_network_os become the host, port, username and platform. Other variables are variables of
+// the devices. Ansible groups, including the parents of nested groups, become groups.
+func LoadAnsible(fn string) (*Inventory, error) {
+	data, err := os.ReadFile(fn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Ansible inventory %q: %v", fn, err)
+	}
+
+	var parsed ansibleInventory
+	switch strings.ToLower(filepath.Ext(fn)) {
+	case ".yaml", ".yml":
+		parsed, err = parseAnsibleYAML(data)
+	default:
+		parsed, err = parseAnsibleINI(string(data))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse Ansible inventory %q: %v", fn, err)
+	}
+	inv, err := parsed.inventory()
+	if err != nil {
+		return nil, fmt.Errorf("invalid Ansible inventory %q: %v", fn, err)
+	}
+	return inv, nil
+}
+
+// inventory converts an Ansible inventory. Variables of parent groups are overridden by the ones of their children,
+// and host variables override all group variables, like in Ansible. Groups that are their own descendants are an
+// error.
+func (a ansibleInventory) inventory() (*Inventory, error) {
+	// The depth of a group is its distance from "all", groups that are nobody's children are right below it.
+	depth := map[string]int{"all": 0}
+	// visiting are the groups from the top down to the current one.
+	visiting := map[string]bool{}
+	var setDepth func(name string, d int) error
+	setDepth = func(name string, d int) error {
+		if visiting[name] {
+			return fmt.Errorf("group %q is a child of itself", name)
+		}
+		if cur, ok := depth[name]; ok && cur >= d {
+			return nil
+		}
+		depth[name] = d
+		visiting[name] = true
+		defer delete(visiting, name)
+		for _, c := range a.group(name).children {
+			if err := setDepth(c, d+1); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	isChild := map[string]bool{}
+	for _, g := range a {
+		for _, c := range g.children {
+			isChild[c] = true
+		}
+	}
+	for _, c := range a.group("all").children {
+		if err := setDepth(c, 1); err != nil {
+			return nil, err
+		}
+	}
+	for name := range a {
+		if name != "all" && !isChild[name] {
+			if err := setDepth(name, 1); err != nil {
+				return nil, err
+			}
+		}
+	}
+	// Groups that are only children of each other weren't reached.
+	for name := range a {
+		if _, ok := depth[name]; !ok {
+			if err := setDepth(name, 1); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// parents maps groups to the groups they're a child of.
+	parents := map[string][]string{}
+	for name, g := range a {
+		for _, c := range g.children {
+			parents[c] = append(parents[c], name)
+		}
+	}
+
+	hostGroups := map[string]map[string]bool{}
+	hostVars := map[string]map[string]string{}
+	var addGroup func(host string, group string)
+	addGroup = func(host string, group string) {
+		if hostGroups[host][group] {
+			return
+		}
+		hostGroups[host][group] = true
+		for _, p := range parents[group] {
+			addGroup(host, p)
+		}
+	}
+	for name, g := range a {
+		for host, vars := range g.hosts {
+			if hostGroups[host] == nil {
+				hostGroups[host] = map[string]bool{}
+				hostVars[host] = map[string]string{}
+			}
+			addGroup(host, name)
+			for k, v := range vars {
+				hostVars[host][k] = v
+			}
+		}
+	}
+
+	inv := New()
+	for name, g := range a {
+		if name == "all" || name == "ungrouped" {
+			continue
+		}
+		_, s := ansibleSettings(g.vars)
+		inv.Groups[name] = s
+	}
+	_, inv.Defaults = ansibleSettings(a.group("all").vars)
+
+	for host, groupSet := range hostGroups {
+		var groups []string
+		for g := range groupSet {
+			if g != "all" && g != "ungrouped" {
+				groups = append(groups, g)
+			}
+		}
+		sort.Slice(groups, func(i, j int) bool {
+			if depth[groups[i]] != depth[groups[j]] {
+				return depth[groups[i]] < depth[groups[j]]
+			}
+			return groups[i] < groups[j]
+		})
+		address, s := ansibleSettings(hostVars[host])
+		inv.add(host, address, groups, s)
+	}
+	return inv, nil
+}
+
+// ansibleSettings converts Ansible variables into settings, and the host to connect to.
+func ansibleSettings(vars map[string]string) (string, Settings) {
+	var host string
+	var s Settings
+	for k, v := range vars {
+		switch k {
+		case "ansible_host":
+			host = v
+		case "ansible_port":
+			s.Port, _ = strconv.Atoi(v)
+		case "ansible_user":
+			s.Username = v
+		case "ansible_network_os":
+			s.Platform = Platform(v)
+		default:
+			if s.Vars == nil {
+				s.Vars = map[string]string{}
+			}
+			s.Vars[k] = v
+		}
+	}
+	return host, s
+}
+
+// parseAnsibleINI parses an Ansible inventory in INI format.
+func parseAnsibleINI(data string) (ansibleInventory, error) {
+	a := ansibleInventory{}
+	a.group("all")
+
+	section := "ungrouped"
+	for i, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+
+		switch {
+		case strings.HasSuffix(section, ":vars"):
+			k, v, ok := strings.Cut(line, "=")
+			if !ok {
+				return nil, fmt.Errorf("line %d: %q is not key=value", i+1, line)
+			}
+			a.group(strings.TrimSuffix(section, ":vars")).vars[strings.TrimSpace(k)] = unquote(strings.TrimSpace(v))
+		case strings.HasSuffix(section, ":children"):
+			parent := strings.TrimSuffix(section, ":children")
+			a.group(parent).children = append(a.group(parent).children, line)
+			a.group(line)
+		default:
+			fields := strings.Fields(line)
+			vars := map[string]string{}
+			for _, f := range fields[1:] {
+				k, v, ok := strings.Cut(f, "=")
+				if !ok {
+					return nil, fmt.Errorf("line %d: %q is not key=value", i+1, f)
+				}
+				vars[k] = unquote(v)
+			}
+			hosts, err := expandHostRange(fields[0])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", i+1, err)
+			}
+			for _, h := range hosts {
+				g := a.group(section)
+				if g.hosts[h] == nil {
+					g.hosts[h] = map[string]string{}
+				}
+				for k, v := range vars {
+					g.hosts[h][k] = v
+				}
+			}
+		}
+	}
+	return a, nil
+}
+
+func unquote(s string) string {
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+// expandHostRange expands a numeric range in a host pattern, like rtr[01:03] into rtr01, rtr02 and rtr03.
+func expandHostRange(pattern string) ([]string, error) {
+	start := strings.Index(pattern, "[")
+	end := strings.Index(pattern, "]")
+	if start < 0 || end < start {
+		return []string{pattern}, nil
+	}
+	from, to, ok := strings.Cut(pattern[start+1:end], ":")
+	if !ok {
+		return nil, fmt.Errorf("invalid host range %q", pattern)
+	}
+	first, err1 := strconv.Atoi(from)
+	last, err2 := strconv.Atoi(to)
+	if err1 != nil || err2 != nil || last < first {
+		return nil, fmt.Errorf("invalid host range %q", pattern)
+	}
+
+	var result []string
+	for n := first; n <= last; n++ {
+		num := fmt.Sprintf("%0*d", len(from), n)
+		rest, err := expandHostRange(pattern[end+1:])
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range rest {
+			result = append(result, pattern[:start]+num+r)
+		}
+	}
+	return result, nil
+}
+
+// ansibleYAMLGroup is a group in an Ansible inventory in YAML format.
+type ansibleYAMLGroup struct {
+	Hosts    map[string]map[string]interface{} `yaml:"hosts"`
+	Vars     map[string]interface{}            `yaml:"vars"`
+	Children map[string]*ansibleYAMLGroup      `yaml:"children"`
+}
+
+// parseAnsibleYAML parses an Ansible inventory in YAML format.
+func parseAnsibleYAML(data []byte) (ansibleInventory, error) {
+	var parsed map[string]*ansibleYAMLGroup
+	if err := yaml.Unmarshal(data, &parsed); err != nil {
+		return nil, err
+	}
+
+	a := ansibleInventory{}
+	a.group("all")
+	var add func(name string, g *ansibleYAMLGroup)
+	add = func(name string, g *ansibleYAMLGroup) {
+		group := a.group(name)
+		if g == nil {
+			return
+		}
+		for k, v := range g.Vars {
+			group.vars[k] = fmt.Sprintf("%v", v)
+		}
+		for h, vars := range g.Hosts {
+			if group.hosts[h] == nil {
+				group.hosts[h] = map[string]string{}
+			}
+			for k, v := range vars {
+				group.hosts[h][k] = fmt.Sprintf("%v", v)
+			}
+		}
+		for c, child := range g.Children {
+			group.children = append(group.children, c)
+			add(c, child)
+		}
+	}
+	for name, g := range parsed {
+		add(name, g)
+	}
+	return a, nil
+}
+
+// platforms maps the names of network operating systems to the platform names of cpush. The names are in lower case
+// without separators.
+var platforms = map[string]string{
+	"ios":          "cisco_ios",
+	"iosxe":        "cisco_ios",
+	"ciscoios":     "cisco_ios",
+	"ciscoiosxe":   "cisco_ios",
+	"nxos":         "cisco_nxos",
+	"cisconxos":    "cisco_nxos",
+	"iosxr":        "cisco_xr",
+	"ciscoiosxr":   "cisco_xr",
+	"ciscoxr":      "cisco_xr",
+	"junos":        "juniper_junos",
+	"juniperjunos": "juniper_junos",
+	"eos":          "arista_eos",
+	"aristaeos":    "arista_eos",
+}
+
+// Platform maps the name of a network operating system, like an ansible_network_os of cisco.ios.ios or a NetBox
+// platform slug of cisco-ios-xe, to a cpush platform like cisco_ios. Unknown names are kept, with "-" replaced by "_".
+func Platform(name string) string {
+	// Ansible collections are namespace.collection.platform.
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		name = name[i+1:]
+	}
+	key := strings.ToLower(strings.NewReplacer("-", "", "_", "").Replace(name))
+	if p, ok := platforms[key]; ok {
+		return p
+	}
+	return strings.ReplaceAll(name, "-", "_")
+}
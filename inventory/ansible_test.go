@@ -0,0 +1,95 @@
+package inventory
+
+import (
+	"testing"
+
+	"github.com/go-test/deep"
+)
+
+func TestLoadAnsible(t *testing.T) {
+	want := map[string]*Device{
+		"rtr-1": {Name: "rtr-1", Groups: []string{"dc", "core"}, Settings: Settings{
+			Platform: "cisco_ios", Username: "netops", Vars: map[string]string{"tier": "1"},
+		}},
+		"rtr-2": {Name: "rtr-2", Groups: []string{"dc", "core"}, Settings: Settings{
+			Platform: "cisco_ios", Username: "netops", Vars: map[string]string{"tier": "1"},
+		}},
+		"rtr-3": {Name: "rtr-3", Host: "10.0.0.3", Groups: []string{"dc", "core"}, Settings: Settings{
+			Port: 2222, Platform: "cisco_ios", Username: "netops", Vars: map[string]string{"tier": "1"},
+		}},
+		"sw-1": {Name: "sw-1", Groups: []string{"dc", "edge"}, Settings: Settings{
+			Platform: "cisco_nxos", Username: "netops",
+		}},
+	}
+
+	for _, fn := range []string{"testdata/ansible.yaml", "testdata/ansible.ini"} {
+		inv, err := LoadAnsible(fn)
+		if err != nil {
+			t.Fatalf("failed to load %q: %v", fn, err)
+		}
+		if diff := deep.Equal(inv.Devices, want); diff != nil {
+			t.Errorf("%s: %v", fn, diff)
+		}
+		got, err := inv.Resolve("group:dc,!group:edge")
+		if err != nil {
+			t.Fatalf("%s: failed to resolve: %v", fn, err)
+		}
+		if diff := deep.Equal(got, []string{"rtr-1", "rtr-2", "rtr-3"}); diff != nil {
+			t.Errorf("%s: %v", fn, diff)
+		}
+	}
+}
+
+func TestExpandHostRange(t *testing.T) {
+	for _, test := range []struct {
+		Pattern string
+		Want    []string
+	}{
+		{"rtr-1", []string{"rtr-1"}},
+		{"rtr[1:3]", []string{"rtr1", "rtr2", "rtr3"}},
+		{"rtr[08:10]", []string{"rtr08", "rtr09", "rtr10"}},
+		{"s[1:2]-p[1:2]", []string{"s1-p1", "s1-p2", "s2-p1", "s2-p2"}},
+	} {
+		got, err := expandHostRange(test.Pattern)
+		if err != nil {
+			t.Errorf("expandHostRange(%q) failed: %v", test.Pattern, err)
+			continue
+		}
+		if diff := deep.Equal(got, test.Want); diff != nil {
+			t.Errorf("expandHostRange(%q): %v", test.Pattern, diff)
+		}
+	}
+}
+
+func TestPlatform(t *testing.T) {
+	for name, want := range map[string]string{
+		"cisco.ios.ios":               "cisco_ios",
+		"ios":                         "cisco_ios",
+		"cisco-ios-xe":                "cisco_ios",
+		"nxos":                        "cisco_nxos",
+		"cisco.iosxr.iosxr":           "cisco_xr",
+		"junipernetworks.junos.junos": "juniper_junos",
+		"arista-eos":                  "arista_eos",
+		"fortinet-fortios":            "fortinet_fortios",
+	} {
+		if got := Platform(name); got != want {
+			t.Errorf("Platform(%q): got %q want %q", name, got, want)
+		}
+	}
+}
+
+func TestAnsibleCycle(t *testing.T) {
+	for _, data := range []string{
+		"[top:children]\ncore\n[core:children]\nedge\n[edge:children]\ncore\n",
+		"[core:children]\nedge\n[edge:children]\ncore\n",
+		"[core:children]\ncore\n",
+	} {
+		a, err := parseAnsibleINI(data)
+		if err != nil {
+			t.Fatalf("failed to parse %q: %v", data, err)
+		}
+		if _, err := a.inventory(); err == nil {
+			t.Errorf("%q: expected an error about the cycle", data)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package inventory
+
+import (
+	"context"
+	"net"
+
+	"github.com/cdevr/cpush/options"
+)
+
+// Dialer returns a dialer that connects to the devices in the inventory at their host and port. viaProxy returns the
+// dialer for a device, or nil if it doesn't need a proxy, then it's dialed with dial. Devices that aren't in the
+// inventory are connected to at the address they were dialed with, and get the default settings.
+//
+// The device is looked up by the name in the context, see options.WithDevice, or else by the host of the address.
+func (inv *Inventory) Dialer(dial options.Dialer, viaProxy func(d *Device) (options.Dialer, error)) options.Dialer {
+	return func(ctx context.Context, network string, addr string) (net.Conn, error) {
+		name, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return dial(ctx, network, addr)
+		}
+		host := name
+		if device := options.DeviceFrom(ctx); device != "" {
+			if _, ok := inv.Devices[device]; ok {
+				name = device
+			}
+		}
+		d := inv.Get(name)
+		if d.Host != "" {
+			host = d.Host
+		}
+		// A port in the address was asked for explicitly, the inventory only overrides the default.
+		if d.Port != 0 && port == "22" {
+			addr = d.Address()
+		} else {
+			addr = net.JoinHostPort(host, port)
+		}
+
+		proxyDial, err := viaProxy(d)
+		if err != nil {
+			return nil, err
+		}
+		if proxyDial == nil {
+			return dial(ctx, network, addr)
+		}
+		return proxyDial(ctx, network, addr)
+	}
+}
@@ -0,0 +1,54 @@
+package inventory
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/cdevr/cpush/options"
+)
+
+func TestDialer(t *testing.T) {
+	inv, err := Load("testdata/inventory.yaml")
+	if err != nil {
+		t.Fatalf("failed to load inventory: %v", err)
+	}
+
+	var dialed []string
+	recorder := func(via string) options.Dialer {
+		return func(ctx context.Context, network string, addr string) (net.Conn, error) {
+			dialed = append(dialed, via+" "+addr)
+			return nil, fmt.Errorf("not really dialing")
+		}
+	}
+	dial := inv.Dialer(recorder("direct"), func(d *Device) (options.Dialer, error) {
+		if d.Proxy == "" {
+			return nil, nil
+		}
+		return recorder(d.Proxy), nil
+	})
+
+	for _, addr := range []string{"rtr-1:22", "rtr-2:22", "rtr-3:22", "sw-1:22", "sw-1:23", "unknown:22"} {
+		dial(context.Background(), "tcp", addr)
+	}
+
+	// The ssh config gave rtr-1 a HostName, the inventory settings still apply by its name.
+	dial(options.WithDevice(context.Background(), "rtr-1"), "tcp", "rtr1.example.net:22")
+	// A device the inventory doesn't know keeps the address of the ssh config.
+	dial(options.WithDevice(context.Background(), "unknown"), "tcp", "unknown.example.net:22")
+
+	want := []string{
+		"direct 10.0.0.1:22",
+		"direct rtr-2:22",
+		"bastion-ams:1080 10.0.0.3:2222",
+		"bastion-ams:1080 sw-1:22",
+		"bastion-ams:1080 sw-1:23",
+		"direct unknown:22",
+		"direct 10.0.0.1:22",
+		"direct unknown.example.net:22",
+	}
+	if fmt.Sprint(dialed) != fmt.Sprint(want) {
+		t.Errorf("dialed %q, want %q", dialed, want)
+	}
+}
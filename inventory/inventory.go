@@ -0,0 +1,378 @@
+// Package inventory describes the devices cpush and rcheck work on, and resolves device selectors from the command
+// line into devices.
+//
+// An inventory is a YAML or INI file with devices, groups and tags. Settings like the username or the proxy can be
+// given as defaults for all devices, per group and per device, the most specific one wins. Inventories can also be
+// read from an Ansible inventory, or from the devices in NetBox.
+package inventory
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Settings are the settings of a device. They can be set per device, per group, and as defaults.
+type Settings struct {
+	Port     int    `yaml:"port"`
+	Platform string `yaml:"platform"`
+	Username string `yaml:"username"`
+	// Credential refers to the credential to log in with, for credential providers.
+	Credential string            `yaml:"credential"`
+	Proxy      string            `yaml:"proxy"`
+	Tags       []string          `yaml:"tags"`
+	Vars       map[string]string `yaml:"vars"`
+}
+
+// merge overrides the settings with the ones that are set in other. Tags and variables are added.
+func (s *Settings) merge(other Settings) {
+	if other.Port != 0 {
+		s.Port = other.Port
+	}
+	if other.Platform != "" {
+		s.Platform = other.Platform
+	}
+	if other.Username != "" {
+		s.Username = other.Username
+	}
+	if other.Credential != "" {
+		s.Credential = other.Credential
+	}
+	if other.Proxy != "" {
+		s.Proxy = other.Proxy
+	}
+	for _, t := range other.Tags {
+		if !contains(s.Tags, t) {
+			s.Tags = append(s.Tags, t)
+		}
+	}
+	if len(other.Vars) > 0 && s.Vars == nil {
+		s.Vars = map[string]string{}
+	}
+	for k, v := range other.Vars {
+		s.Vars[k] = v
+	}
+}
+
+// HasTag returns true if a device has a tag. A tag is a word like "edge", or a key and value like "site=ams". A
+// selector of just the key matches all values.
+func (s *Settings) HasTag(tag string) bool {
+	for _, t := range s.Tags {
+		if t == tag || strings.HasPrefix(t, tag+"=") {
+			return true
+		}
+	}
+	return false
+}
+
+// Device is a device in the inventory.
+type Device struct {
+	Name string
+	// Host is the hostname or address to connect to. It's the name if it isn't set.
+	Host   string
+	Groups []string
+	Settings
+}
+
+// Address returns the address to connect to, with the port if it's set.
+func (d *Device) Address() string {
+	host := d.Host
+	if host == "" {
+		host = d.Name
+	}
+	if d.Port != 0 {
+		return net.JoinHostPort(host, strconv.Itoa(d.Port))
+	}
+	return host
+}
+
+// InGroup returns true if the device is a member of the group.
+func (d *Device) InGroup(group string) bool {
+	return contains(d.Groups, group)
+}
+
+func contains(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Inventory is a set of devices.
+type Inventory struct {
+	Defaults Settings
+	Groups   map[string]Settings
+	Devices  map[string]*Device
+}
+
+// New returns an empty inventory.
+func New() *Inventory {
+	return &Inventory{Groups: map[string]Settings{}, Devices: map[string]*Device{}}
+}
+
+// Names returns the names of all devices, sorted.
+func (inv *Inventory) Names() []string {
+	var result []string
+	for name := range inv.Devices {
+		result = append(result, name)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// Get returns a device. A device that isn't in the inventory gets the defaults.
+func (inv *Inventory) Get(name string) *Device {
+	if d, ok := inv.Devices[name]; ok {
+		return d
+	}
+	d := &Device{Name: name}
+	d.merge(inv.Defaults)
+	return d
+}
+
+// add adds a device with its settings, applying the defaults and the settings of its groups first.
+func (inv *Inventory) add(name string, host string, groups []string, settings Settings) {
+	d := &Device{Name: name, Host: host, Groups: groups}
+	d.merge(inv.Defaults)
+	for _, g := range groups {
+		d.merge(inv.Groups[g])
+	}
+	d.merge(settings)
+	inv.Devices[name] = d
+}
+
+// Load reads an inventory from a YAML or INI file.
+func Load(fn string) (*Inventory, error) {
+	data, err := os.ReadFile(fn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read inventory %q: %v", fn, err)
+	}
+
+	var inv *Inventory
+	switch strings.ToLower(filepath.Ext(fn)) {
+	case ".yaml", ".yml":
+		inv, err = parseYAML(data)
+	case ".ini":
+		inv, err = parseINI(string(data))
+	default:
+		return nil, fmt.Errorf("inventory %q isn't .yaml, .yml or .ini", fn)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse inventory %q: %v", fn, err)
+	}
+	return inv, nil
+}
+
+// NetBoxTokenEnv is the environment variable with the API token for NetBox inventories.
+const NetBoxTokenEnv = "NETBOX_TOKEN"
+
+// Open opens an inventory from a specification, which is one of:
+//   - a YAML or INI inventory file
+//   - ansible: followed by an Ansible inventory file in INI or YAML format
+//   - netbox: followed by the URL of NetBox with filters, like netbox:https://netbox.example.com/?site=ams&status=active.
+//     The API token is read from $NETBOX_TOKEN.
+//
+// Files can start with ~/ for the home directory.
+func Open(ctx context.Context, spec string) (*Inventory, error) {
+	if u := strings.TrimPrefix(spec, "netbox:"); u != spec {
+		baseURL, filter, err := parseNetBoxSpec(u)
+		if err != nil {
+			return nil, err
+		}
+		return LoadNetBox(ctx, &http.Client{Timeout: time.Minute}, baseURL, os.Getenv(NetBoxTokenEnv), filter)
+	}
+	if fn := strings.TrimPrefix(spec, "ansible:"); fn != spec {
+		return LoadAnsible(expandHome(fn))
+	}
+	return Load(expandHome(spec))
+}
+
+// expandHome replaces a leading ~/ with the home directory.
+func expandHome(fn string) string {
+	if !strings.HasPrefix(fn, "~/") {
+		return fn
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return fn
+	}
+	return filepath.Join(home, fn[2:])
+}
+
+type yamlDevice struct {
+	Host     string   `yaml:"host"`
+	Groups   []string `yaml:"groups"`
+	Settings `yaml:",inline"`
+}
+
+type yamlInventory struct {
+	Defaults Settings              `yaml:"defaults"`
+	Groups   map[string]Settings   `yaml:"groups"`
+	Devices  map[string]yamlDevice `yaml:"devices"`
+}
+
+// parseYAML parses an inventory like:
+//
+//	defaults:
+//	  username: netops
+//	groups:
+//	  core:
+//	    tags: [tier=1]
+//	devices:
+//	  rtr-1:
+//	    host: 10.0.0.1
+//	    groups: [core]
+//	    tags: [site=ams]
+//	    vars:
+//	      loopback: 10.255.0.1
+func parseYAML(data []byte) (*Inventory, error) {
+	var parsed yamlInventory
+	if err := yaml.Unmarshal(data, &parsed); err != nil {
+		return nil, err
+	}
+
+	inv := New()
+	inv.Defaults = parsed.Defaults
+	for name, g := range parsed.Groups {
+		inv.Groups[name] = g
+	}
+	for name, d := range parsed.Devices {
+		for _, g := range d.Groups {
+			if _, ok := inv.Groups[g]; !ok {
+				inv.Groups[g] = Settings{}
+			}
+		}
+		inv.add(name, d.Host, d.Groups, d.Settings)
+	}
+	return inv, nil
+}
+
+// parseINI parses an inventory like:
+//
+//	[defaults]
+//	username=netops
+//
+//	[core:settings]
+//	tags=tier=1
+//
+//	[core]
+//	rtr-1 host=10.0.0.1 tags=site=ams loopback=10.255.0.1
+//
+// Every section is a group, except [defaults]. The settings of a group are in a [group:settings] section. Keys that
+// aren't settings are variables. Devices in more than one section are in all those groups.
+func parseINI(data string) (*Inventory, error) {
+	inv := New()
+
+	type entry struct {
+		host     string
+		groups   []string
+		settings Settings
+	}
+	entries := map[string]*entry{}
+	var order []string
+
+	section := ""
+	for i, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			if group := strings.TrimSuffix(section, ":settings"); group != section {
+				inv.Groups[group] = inv.Groups[group]
+			} else if section != "defaults" {
+				inv.Groups[section] = inv.Groups[section]
+			}
+			continue
+		}
+
+		switch {
+		case section == "":
+			return nil, fmt.Errorf("line %d: %q is not in a section", i+1, line)
+		case section == "defaults":
+			if err := setINIValue(&inv.Defaults, nil, line); err != nil {
+				return nil, fmt.Errorf("line %d: %v", i+1, err)
+			}
+		case strings.HasSuffix(section, ":settings"):
+			group := strings.TrimSuffix(section, ":settings")
+			s := inv.Groups[group]
+			if err := setINIValue(&s, nil, line); err != nil {
+				return nil, fmt.Errorf("line %d: %v", i+1, err)
+			}
+			inv.Groups[group] = s
+		default:
+			fields := strings.Fields(line)
+			name := fields[0]
+			e, ok := entries[name]
+			if !ok {
+				e = &entry{}
+				entries[name] = e
+				order = append(order, name)
+			}
+			e.groups = append(e.groups, section)
+			for _, f := range fields[1:] {
+				if err := setINIValue(&e.settings, &e.host, f); err != nil {
+					return nil, fmt.Errorf("line %d: %v", i+1, err)
+				}
+			}
+		}
+	}
+
+	// Devices are added after all group settings are known.
+	for _, name := range order {
+		e := entries[name]
+		inv.add(name, e.host, e.groups, e.settings)
+	}
+	return inv, nil
+}
+
+// setINIValue sets a key=value in the settings. Unknown keys are variables. host is only allowed for devices.
+func setINIValue(s *Settings, host *string, kv string) error {
+	key, value, ok := strings.Cut(kv, "=")
+	if !ok {
+		return fmt.Errorf("%q is not key=value", kv)
+	}
+	key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+
+	switch key {
+	case "host":
+		if host == nil {
+			return fmt.Errorf("host can only be set on a device")
+		}
+		*host = value
+	case "port":
+		port, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("invalid port %q", value)
+		}
+		s.Port = port
+	case "platform":
+		s.Platform = value
+	case "username":
+		s.Username = value
+	case "credential":
+		s.Credential = value
+	case "proxy":
+		s.Proxy = value
+	case "tags":
+		s.Tags = append(s.Tags, strings.Split(value, ",")...)
+	default:
+		if s.Vars == nil {
+			s.Vars = map[string]string{}
+		}
+		s.Vars[key] = value
+	}
+	return nil
+}
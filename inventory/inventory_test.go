@@ -0,0 +1,93 @@
+package inventory
+
+import (
+	"testing"
+
+	"github.com/go-test/deep"
+)
+
+func TestLoad(t *testing.T) {
+	want := map[string]*Device{
+		"rtr-1": {Name: "rtr-1", Host: "10.0.0.1", Groups: []string{"core"}, Settings: Settings{
+			Platform: "cisco_ios", Username: "netops", Credential: "core-admin",
+			Tags: []string{"tier=1", "site=ams"}, Vars: map[string]string{"loopback": "10.255.0.1"},
+		}},
+		"rtr-2": {Name: "rtr-2", Groups: []string{"core"}, Settings: Settings{
+			Platform: "cisco_ios", Username: "netops", Credential: "core-admin", Tags: []string{"tier=1", "site=fra"},
+		}},
+		"rtr-3": {Name: "rtr-3", Host: "10.0.0.3", Groups: []string{"core", "edge"}, Settings: Settings{
+			Port: 2222, Platform: "cisco_ios", Username: "admin", Credential: "core-admin",
+			Proxy: "bastion-ams:1080", Tags: []string{"tier=1", "site=ams"},
+		}},
+		"sw-1": {Name: "sw-1", Groups: []string{"edge"}, Settings: Settings{
+			Platform: "cisco_nxos", Username: "netops", Proxy: "bastion-ams:1080", Tags: []string{"site=ams"},
+		}},
+	}
+
+	for _, fn := range []string{"testdata/inventory.yaml", "testdata/inventory.ini"} {
+		inv, err := Load(fn)
+		if err != nil {
+			t.Fatalf("failed to load %q: %v", fn, err)
+		}
+		if diff := deep.Equal(inv.Devices, want); diff != nil {
+			t.Errorf("%s: %v", fn, diff)
+		}
+	}
+}
+
+func TestAddress(t *testing.T) {
+	inv, err := Load("testdata/inventory.yaml")
+	if err != nil {
+		t.Fatalf("failed to load inventory: %v", err)
+	}
+	for name, want := range map[string]string{
+		"rtr-1":   "10.0.0.1",
+		"rtr-2":   "rtr-2",
+		"rtr-3":   "10.0.0.3:2222",
+		"unknown": "unknown",
+	} {
+		if got := inv.Get(name).Address(); got != want {
+			t.Errorf("address of %q: got %q want %q", name, got, want)
+		}
+	}
+	if got := inv.Get("unknown").Username; got != "netops" {
+		t.Errorf("device that isn't in the inventory got username %q, want the default", got)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	inv, err := Load("testdata/inventory.yaml")
+	if err != nil {
+		t.Fatalf("failed to load inventory: %v", err)
+	}
+
+	for _, test := range []struct {
+		Spec string
+		Want []string
+	}{
+		{"rtr-9", []string{"rtr-9"}},
+		{"rtr-1, rtr-9,", []string{"rtr-1", "rtr-9"}},
+		{"group:core", []string{"rtr-1", "rtr-2", "rtr-3"}},
+		{"group:core,tag:site=ams,!rtr-3", []string{"rtr-1", "rtr-2", "sw-1"}},
+		{"group:core,&tag:site=ams", []string{"rtr-1", "rtr-3"}},
+		{"tag:tier", []string{"rtr-1", "rtr-2", "rtr-3"}},
+		{"rtr-*,!group:edge", []string{"rtr-1", "rtr-2"}},
+		{"all,!rtr-*", []string{"sw-1"}},
+	} {
+		got, err := inv.Resolve(test.Spec)
+		if err != nil {
+			t.Errorf("Resolve(%q) failed: %v", test.Spec, err)
+			continue
+		}
+		if diff := deep.Equal(got, test.Want); diff != nil {
+			t.Errorf("Resolve(%q): %v", test.Spec, diff)
+		}
+	}
+
+	if _, err := inv.Resolve("group:nonexistent"); err == nil {
+		t.Errorf("expected an error for an unknown group")
+	}
+	if _, err := New().Resolve("tag:site=ams"); err != nil {
+		t.Errorf("selecting on an empty inventory failed: %v", err)
+	}
+}
@@ -0,0 +1,185 @@
+package inventory
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// NetBoxFilter selects devices from NetBox. Every field is a list of slugs, devices match if they match any of them.
+// Empty fields don't filter.
+type NetBoxFilter struct {
+	Site   []string
+	Role   []string
+	Tag    []string
+	Status []string
+}
+
+// query returns the filter as the query parameters of the NetBox devices endpoint.
+func (f NetBoxFilter) query() url.Values {
+	q := url.Values{}
+	for _, s := range f.Site {
+		q.Add("site", s)
+	}
+	for _, r := range f.Role {
+		q.Add("role", r)
+	}
+	for _, t := range f.Tag {
+		q.Add("tag", t)
+	}
+	for _, s := range f.Status {
+		q.Add("status", s)
+	}
+	return q
+}
+
+type netboxSlug struct {
+	Slug string `json:"slug"`
+}
+
+type netboxDevice struct {
+	Name      string `json:"name"`
+	PrimaryIP *struct {
+		Address string `json:"address"`
+	} `json:"primary_ip"`
+	Platform *netboxSlug `json:"platform"`
+	Site     *netboxSlug `json:"site"`
+	Role     *netboxSlug `json:"role"`
+	// DeviceRole is the role in NetBox versions before 3.6.
+	DeviceRole *netboxSlug `json:"device_role"`
+	Status     *struct {
+		Value string `json:"value"`
+	} `json:"status"`
+	Tags []netboxSlug `json:"tags"`
+}
+
+type netboxPage struct {
+	Next    string         `json:"next"`
+	Results []netboxDevice `json:"results"`
+}
+
+// LoadNetBox reads the devices that match the filter from the devices endpoint of the NetBox REST API at baseURL, like
+// https://netbox.example.com. The token is sent as API token if it's set.
+//
+// Devices connect to their primary IP, or their name if they have none. The platform is mapped from the platform
+// slug. Devices are in a group per role, and get the tags site=, role= and status=, in addition to their NetBox tags.
+func LoadNetBox(ctx context.Context, client *http.Client, baseURL string, token string, filter NetBoxFilter) (*Inventory, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	q := filter.query()
+	q.Set("limit", "1000")
+	next := strings.TrimSuffix(baseURL, "/") + "/api/dcim/devices/?" + q.Encode()
+
+	inv := New()
+	for next != "" {
+		page, err := getNetBoxPage(ctx, client, next, token)
+		if err != nil {
+			return nil, err
+		}
+		for _, d := range page.Results {
+			if d.Name == "" {
+				continue
+			}
+			addNetBoxDevice(inv, d)
+		}
+		next = page.Next
+	}
+	return inv, nil
+}
+
+func getNetBoxPage(ctx context.Context, client *http.Client, u string, token string) (*netboxPage, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create NetBox request: %v", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Token "+token)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query NetBox: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("NetBox returned %s for %q", resp.Status, u)
+	}
+
+	var page netboxPage
+	if err := json.NewDecoder(resp.Body).Decode(&page); err != nil {
+		return nil, fmt.Errorf("failed to parse NetBox response: %v", err)
+	}
+	return &page, nil
+}
+
+func addNetBoxDevice(inv *Inventory, d netboxDevice) {
+	var host string
+	if d.PrimaryIP != nil {
+		// NetBox addresses have a prefix length, like 10.0.0.1/32.
+		host, _, _ = strings.Cut(d.PrimaryIP.Address, "/")
+	}
+
+	var s Settings
+	if d.Platform != nil {
+		s.Platform = Platform(d.Platform.Slug)
+	}
+	if d.Site != nil {
+		s.Tags = append(s.Tags, "site="+d.Site.Slug)
+	}
+	role := d.Role
+	if role == nil {
+		role = d.DeviceRole
+	}
+	var groups []string
+	if role != nil {
+		s.Tags = append(s.Tags, "role="+role.Slug)
+		groups = append(groups, role.Slug)
+		if _, ok := inv.Groups[role.Slug]; !ok {
+			inv.Groups[role.Slug] = Settings{}
+		}
+	}
+	if d.Status != nil {
+		s.Tags = append(s.Tags, "status="+d.Status.Value)
+	}
+	for _, t := range d.Tags {
+		s.Tags = append(s.Tags, t.Slug)
+	}
+	inv.add(d.Name, host, groups, s)
+}
+
+// parseNetBoxSpec parses a NetBox inventory specification, a URL with the filters as query parameters, like
+// https://netbox.example.com/?site=ams&role=core&status=active. It returns the base URL and the filter.
+func parseNetBoxSpec(spec string) (string, NetBoxFilter, error) {
+	u, err := url.Parse(spec)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return "", NetBoxFilter{}, fmt.Errorf("invalid NetBox URL %q", spec)
+	}
+	q := u.Query()
+	var filter NetBoxFilter
+	for key, values := range q {
+		var list []string
+		for _, v := range values {
+			list = append(list, strings.Split(v, ",")...)
+		}
+		switch key {
+		case "site":
+			filter.Site = list
+		case "role":
+			filter.Role = list
+		case "tag":
+			filter.Tag = list
+		case "status":
+			filter.Status = list
+		default:
+			return "", NetBoxFilter{}, fmt.Errorf("unknown NetBox filter %q, use site, role, tag or status", key)
+		}
+	}
+	u.RawQuery = ""
+	u.Fragment = ""
+	return strings.TrimSuffix(u.String(), "/"), filter, nil
+}
@@ -0,0 +1,96 @@
+package inventory
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-test/deep"
+)
+
+func TestLoadNetBox(t *testing.T) {
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/dcim/devices/" {
+			http.NotFound(w, r)
+			return
+		}
+		if got := r.Header.Get("Authorization"); got != "Token secret" {
+			http.Error(w, "bad token "+got, http.StatusForbidden)
+			return
+		}
+		q := r.URL.Query()
+		if diff := deep.Equal(q["site"], []string{"ams", "fra"}); diff != nil {
+			t.Errorf("site filter: %v", diff)
+		}
+		if got := q.Get("status"); got != "active" {
+			t.Errorf("status filter: got %q want active", got)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if q.Get("offset") == "" {
+			fmt.Fprintf(w, `{"next": "%s/api/dcim/devices/?site=ams&site=fra&status=active&offset=1", "results": [
+				{"name": "rtr-1", "primary_ip": {"address": "10.0.0.1/32"}, "platform": {"slug": "cisco-ios"},
+				 "site": {"slug": "ams"}, "role": {"slug": "core"}, "status": {"value": "active"},
+				 "tags": [{"slug": "tier-1"}]}
+			]}`, srv.URL)
+			return
+		}
+		fmt.Fprint(w, `{"next": null, "results": [
+			{"name": "sw-1", "primary_ip": null, "platform": {"slug": "nxos"},
+			 "site": {"slug": "fra"}, "device_role": {"slug": "access"}, "status": {"value": "active"}, "tags": []},
+			{"name": null}
+		]}`)
+	}))
+	defer srv.Close()
+
+	inv, err := Open(context.Background(), "netbox:"+srv.URL+"/?site=ams,fra&status=active")
+	if err == nil {
+		t.Errorf("expected an error without token, got inventory %v", inv.Names())
+	}
+
+	t.Setenv(NetBoxTokenEnv, "secret")
+	inv, err = Open(context.Background(), "netbox:"+srv.URL+"/?site=ams,fra&status=active")
+	if err != nil {
+		t.Fatalf("failed to load NetBox inventory: %v", err)
+	}
+	want := map[string]*Device{
+		"rtr-1": {Name: "rtr-1", Host: "10.0.0.1", Groups: []string{"core"}, Settings: Settings{
+			Platform: "cisco_ios", Tags: []string{"site=ams", "role=core", "status=active", "tier-1"},
+		}},
+		"sw-1": {Name: "sw-1", Groups: []string{"access"}, Settings: Settings{
+			Platform: "cisco_nxos", Tags: []string{"site=fra", "role=access", "status=active"},
+		}},
+	}
+	if diff := deep.Equal(inv.Devices, want); diff != nil {
+		t.Error(diff)
+	}
+
+	got, err := inv.Resolve("tag:site=ams,group:access")
+	if err != nil {
+		t.Fatalf("failed to resolve: %v", err)
+	}
+	if diff := deep.Equal(got, []string{"rtr-1", "sw-1"}); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestParseNetBoxSpec(t *testing.T) {
+	base, filter, err := parseNetBoxSpec("https://netbox.example.com/?role=core&tag=prod&status=active,planned")
+	if err != nil {
+		t.Fatalf("failed to parse: %v", err)
+	}
+	if base != "https://netbox.example.com" {
+		t.Errorf("got base URL %q", base)
+	}
+	want := NetBoxFilter{Role: []string{"core"}, Tag: []string{"prod"}, Status: []string{"active", "planned"}}
+	if diff := deep.Equal(filter, want); diff != nil {
+		t.Error(diff)
+	}
+
+	if _, _, err := parseNetBoxSpec("https://netbox.example.com/?rack=1"); err == nil {
+		t.Errorf("expected an error for an unknown filter")
+	}
+}
@@ -0,0 +1,137 @@
+package inventory
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+)
+
+// Resolve turns a device specification from the command line into device names. A specification is a
+// comma-separated list of selectors, or "file:" followed by a file with a selector per line.
+//
+// A selector is one of:
+//   - a device name, which doesn't have to be in the inventory
+//   - a pattern like "rtr-*" that matches device names in the inventory
+//   - group:name for the devices in a group
+//   - tag:key=value or tag:key for the devices with a tag
+//   - all for all devices in the inventory
+//
+// Selectors add devices, unless they start with "&", which keeps only the devices that also match, or "!", which
+// removes the devices that match. So "group:core,&tag:site=ams,!rtr-3" are the core devices in ams, except rtr-3.
+func (inv *Inventory) Resolve(spec string) ([]string, error) {
+	if fn := strings.TrimPrefix(spec, "file:"); fn != spec {
+		data, err := os.ReadFile(fn)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read devices list file %q: %v", fn, err)
+		}
+		return inv.Select(strings.Split(string(data), "\n"))
+	}
+	return inv.Select(strings.Split(spec, ","))
+}
+
+// Select returns the devices that match a list of selectors, see Resolve. Empty selectors are ignored.
+func (inv *Inventory) Select(selectors []string) ([]string, error) {
+	var add, intersect, remove []string
+	for _, s := range selectors {
+		s = strings.TrimSpace(s)
+		switch {
+		case s == "":
+		case strings.HasPrefix(s, "&"):
+			intersect = append(intersect, s[1:])
+		case strings.HasPrefix(s, "!"):
+			remove = append(remove, s[1:])
+		default:
+			add = append(add, s)
+		}
+	}
+
+	var result []string
+	seen := map[string]bool{}
+	for _, s := range add {
+		matches, err := inv.match(s)
+		if err != nil {
+			return nil, err
+		}
+		for _, d := range matches {
+			if !seen[d] {
+				seen[d] = true
+				result = append(result, d)
+			}
+		}
+	}
+
+	for _, s := range intersect {
+		matches, err := inv.match(s)
+		if err != nil {
+			return nil, err
+		}
+		result = filter(result, setOf(matches), true)
+	}
+	for _, s := range remove {
+		matches, err := inv.match(s)
+		if err != nil {
+			return nil, err
+		}
+		result = filter(result, setOf(matches), false)
+	}
+	return result, nil
+}
+
+// match returns the devices that match a single selector.
+func (inv *Inventory) match(selector string) ([]string, error) {
+	var result []string
+	switch {
+	case strings.HasPrefix(selector, "group:"):
+		group := strings.TrimPrefix(selector, "group:")
+		if _, ok := inv.Groups[group]; !ok {
+			return nil, fmt.Errorf("unknown group %q in selector %q", group, selector)
+		}
+		for _, name := range inv.Names() {
+			if inv.Devices[name].InGroup(group) {
+				result = append(result, name)
+			}
+		}
+	case strings.HasPrefix(selector, "tag:"):
+		tag := strings.TrimPrefix(selector, "tag:")
+		for _, name := range inv.Names() {
+			if inv.Devices[name].HasTag(tag) {
+				result = append(result, name)
+			}
+		}
+	case selector == "all":
+		result = inv.Names()
+	case strings.ContainsAny(selector, "*?["):
+		for _, name := range inv.Names() {
+			ok, err := path.Match(selector, name)
+			if err != nil {
+				return nil, fmt.Errorf("invalid pattern %q: %v", selector, err)
+			}
+			if ok {
+				result = append(result, name)
+			}
+		}
+	default:
+		result = []string{selector}
+	}
+	return result, nil
+}
+
+func setOf(devices []string) map[string]bool {
+	result := map[string]bool{}
+	for _, d := range devices {
+		result[d] = true
+	}
+	return result
+}
+
+// filter keeps the devices that are in the set if keep is true, or the ones that aren't if keep is false.
+func filter(devices []string, set map[string]bool, keep bool) []string {
+	var result []string
+	for _, d := range devices {
+		if set[d] == keep {
+			result = append(result, d)
+		}
+	}
+	return result
+}
@@ -0,0 +1,288 @@
+// Package jump connects to devices through SSH jump hosts, also known as bastions.
+//
+// A Pool holds the SSH connections to a chain of jump hosts, and opens TCP connections to devices as channels on the
+// last one, like ssh -J. The connections to the jump hosts are shared by everything that dials through the pool, and
+// are only reopened when they break.
+package jump
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/cdevr/cpush/options"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// Hop is a jump host.
+type Hop struct {
+	User string
+	// Addr is the host and port of the jump host.
+	Addr string
+}
+
+func (h Hop) String() string {
+	return h.User + "@" + h.Addr
+}
+
+// ParseHops parses a comma-separated list of jump hosts like user@bastion,user@bastion2:2222. The connections go
+// through the jump hosts in order. Jump hosts without a user get defaultUser, and without a port get port 22.
+func ParseHops(spec string, defaultUser string) ([]Hop, error) {
+	var result []Hop
+	for _, s := range strings.Split(spec, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		hop := Hop{User: defaultUser, Addr: s}
+		if i := strings.LastIndex(s, "@"); i >= 0 {
+			hop.User, hop.Addr = s[:i], s[i+1:]
+		}
+		if hop.User == "" || hop.Addr == "" {
+			return nil, fmt.Errorf("invalid jump host %q, want user@host[:port]", s)
+		}
+		if _, _, err := net.SplitHostPort(hop.Addr); err != nil {
+			hop.Addr = net.JoinHostPort(hop.Addr, "22")
+		}
+		result = append(result, hop)
+	}
+	if len(result) == 0 {
+		return nil, fmt.Errorf("no jump hosts in %q", spec)
+	}
+	return result, nil
+}
+
+func respondInteractive(password string) func(user, instruction string, questions []string, echos []bool) ([]string, error) {
+	return func(user, instruction string, questions []string, echos []bool) ([]string, error) {
+		var answers []string
+		for range questions {
+			answers = append(answers, password)
+		}
+		return answers, nil
+	}
+}
+
+// Auth returns the ways to log in to jump hosts: the keys in the ssh-agent at $SSH_AUTH_SOCK if there is one, and
+// the password. The connection to the agent is closed with the returned closer, once the jump hosts are logged in to
+// for the last time.
+func Auth(password string) ([]ssh.AuthMethod, io.Closer) {
+	var result []ssh.AuthMethod
+	var agentConn io.Closer = noAgent{}
+	if sock := os.Getenv("SSH_AUTH_SOCK"); sock != "" {
+		if conn, err := net.Dial("unix", sock); err == nil {
+			result = append(result, ssh.PublicKeysCallback(agent.NewClient(conn).Signers))
+			agentConn = conn
+		}
+	}
+	return append(result,
+		ssh.Password(password),
+		ssh.KeyboardInteractive(respondInteractive(password)),
+	), agentConn
+}
+
+// noAgent is the closer of Auth when there's no ssh-agent.
+type noAgent struct{}
+
+func (noAgent) Close() error { return nil }
+
+var (
+	poolsMu sync.Mutex
+	pools   = map[string]*Pool{}
+)
+
+// Via returns a dialer through the jump hosts in spec, see ParseHops. Everything that dials through the same jump
+// hosts shares a pool, so the connections to them are shared too. The pool logs in with the password, see Auth, and
+// connects to the first jump host with dial, of whichever call created it.
+func Via(spec string, defaultUser string, password string, dial options.Dialer) (options.Dialer, error) {
+	hops, err := ParseHops(spec, defaultUser)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, h := range hops {
+		names = append(names, h.String())
+	}
+	key := strings.Join(names, ",")
+
+	poolsMu.Lock()
+	defer poolsMu.Unlock()
+	p, ok := pools[key]
+	if !ok {
+		auth, agentConn := Auth(password)
+		p = NewPool(hops, auth, dial)
+		p.agentConn = agentConn
+		pools[key] = p
+	}
+	return p.Dial, nil
+}
+
+// Pool dials through a chain of jump hosts. It's safe for concurrent use.
+type Pool struct {
+	hops []Hop
+	auth []ssh.AuthMethod
+	dial options.Dialer
+	// agentConn is the connection to the ssh-agent used by auth, if the pool made auth itself.
+	agentConn io.Closer
+
+	mu sync.Mutex
+	// clients are the connections to the hops, clients[i] goes through clients[i-1]. A nil client isn't connected.
+	clients []*ssh.Client
+	closed  bool
+}
+
+// NewPool returns a pool that connects to the first hop with dial, and logs in to all hops with auth.
+func NewPool(hops []Hop, auth []ssh.AuthMethod, dial options.Dialer) *Pool {
+	return &Pool{
+		hops:    hops,
+		auth:    auth,
+		dial:    dial,
+		clients: make([]*ssh.Client, len(hops)),
+	}
+}
+
+// Dial opens a connection to addr from the last jump host. It's an options.Dialer.
+func (p *Pool) Dial(ctx context.Context, network string, addr string) (net.Conn, error) {
+	client, err := p.client(ctx)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := dialContext(ctx, client, network, addr)
+	if err != nil && ctx.Err() == nil {
+		// The connection to the jump host may have broken without us noticing yet, so try once more on a fresh one.
+		p.drop(client)
+		if client, err = p.client(ctx); err != nil {
+			return nil, err
+		}
+		conn, err = dialContext(ctx, client, network, addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %q through jump host %s: %v", addr, p.hops[len(p.hops)-1], err)
+	}
+	return conn, nil
+}
+
+// Close closes the connections to all jump hosts. Connections through them are closed too.
+func (p *Pool) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	p.closeFrom(0)
+	if p.agentConn != nil {
+		return p.agentConn.Close()
+	}
+	return nil
+}
+
+// client returns the connection to the last hop, connecting to the hops that aren't connected.
+func (p *Pool) client(ctx context.Context) (*ssh.Client, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return nil, fmt.Errorf("jump host pool is closed")
+	}
+
+	for i, hop := range p.hops {
+		if p.clients[i] != nil {
+			continue
+		}
+		var conn net.Conn
+		var err error
+		if i == 0 {
+			conn, err = p.dial(ctx, "tcp", hop.Addr)
+		} else {
+			conn, err = dialContext(ctx, p.clients[i-1], "tcp", hop.Addr)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to jump host %s: %v", hop, err)
+		}
+		client, err := handshake(ctx, conn, hop, p.auth)
+		if err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to log in to jump host %s: %v", hop, err)
+		}
+		p.clients[i] = client
+		go func() {
+			client.Wait()
+			p.drop(client)
+		}()
+	}
+	return p.clients[len(p.clients)-1], nil
+}
+
+// drop forgets a connection to a hop that broke, and closes the connections that went through it.
+func (p *Pool) drop(client *ssh.Client) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i, c := range p.clients {
+		if c == client {
+			p.closeFrom(i)
+			return
+		}
+	}
+}
+
+// closeFrom closes the connections to hop i and the hops after it. The caller must hold the lock.
+func (p *Pool) closeFrom(i int) {
+	for j := len(p.clients) - 1; j >= i; j-- {
+		if p.clients[j] != nil {
+			p.clients[j].Close()
+			p.clients[j] = nil
+		}
+	}
+}
+
+// handshake logs in to a hop over conn, giving up when the context is done.
+func handshake(ctx context.Context, conn net.Conn, hop Hop, auth []ssh.AuthMethod) (*ssh.Client, error) {
+	config := &ssh.ClientConfig{
+		User:            hop.User,
+		Auth:            auth,
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	}
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-stop:
+		}
+	}()
+
+	sshconn, chans, reqs, err := ssh.NewClientConn(conn, hop.Addr, config)
+	if err != nil {
+		return nil, err
+	}
+	return ssh.NewClient(sshconn, chans, reqs), nil
+}
+
+// dialContext opens a connection through an SSH client, giving up when the context is done.
+func dialContext(ctx context.Context, client *ssh.Client, network string, addr string) (net.Conn, error) {
+	type result struct {
+		conn net.Conn
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		conn, err := client.Dial(network, addr)
+		done <- result{conn, err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.conn, r.err
+	case <-ctx.Done():
+		go func() {
+			if r := <-done; r.conn != nil {
+				r.conn.Close()
+			}
+		}()
+		return nil, ctx.Err()
+	}
+}
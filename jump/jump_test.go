@@ -0,0 +1,278 @@
+package jump
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+	"golang.org/x/crypto/ssh"
+)
+
+// bastion is an SSH server that only forwards connections, like a jump host.
+type bastion struct {
+	addr   string
+	logins int32
+
+	mu    sync.Mutex
+	conns []*ssh.ServerConn
+}
+
+func startBastion(t *testing.T) *bastion {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate host key: %v", err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatalf("failed to make signer: %v", err)
+	}
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(c ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if c.User() == "jumper" && string(password) == "secret" {
+				return nil, nil
+			}
+			return nil, io.EOF
+		},
+	}
+	config.AddHostKey(signer)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	b := &bastion{addr: l.Addr().String()}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go b.serve(conn, config)
+		}
+	}()
+	return b
+}
+
+func (b *bastion) serve(conn net.Conn, config *ssh.ServerConfig) {
+	sconn, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	atomic.AddInt32(&b.logins, 1)
+	b.mu.Lock()
+	b.conns = append(b.conns, sconn)
+	b.mu.Unlock()
+
+	go ssh.DiscardRequests(reqs)
+	for nc := range chans {
+		if nc.ChannelType() != "direct-tcpip" {
+			nc.Reject(ssh.UnknownChannelType, "only forwarding")
+			continue
+		}
+		var target struct {
+			Host     string
+			Port     uint32
+			OrigHost string
+			OrigPort uint32
+		}
+		if err := ssh.Unmarshal(nc.ExtraData(), &target); err != nil {
+			nc.Reject(ssh.ConnectionFailed, err.Error())
+			continue
+		}
+		out, err := net.Dial("tcp", net.JoinHostPort(target.Host, strconv.Itoa(int(target.Port))))
+		if err != nil {
+			nc.Reject(ssh.ConnectionFailed, err.Error())
+			continue
+		}
+		ch, creqs, err := nc.Accept()
+		if err != nil {
+			out.Close()
+			continue
+		}
+		go ssh.DiscardRequests(creqs)
+		go func() {
+			io.Copy(ch, out)
+			ch.Close()
+		}()
+		go func() {
+			io.Copy(out, ch)
+			out.Close()
+		}()
+	}
+}
+
+// kill breaks all connections to the bastion.
+func (b *bastion) kill() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, c := range b.conns {
+		c.Close()
+	}
+	b.conns = nil
+}
+
+// startEcho starts a server that echoes what it receives.
+func startEcho(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				io.Copy(conn, conn)
+				conn.Close()
+			}()
+		}
+	}()
+	return l.Addr().String()
+}
+
+// echoThrough sends a message to the echo server through the pool. It can be called from other goroutines.
+func echoThrough(t *testing.T, p *Pool, addr string, msg string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, err := p.Dial(ctx, "tcp", addr)
+	if err != nil {
+		t.Errorf("failed to dial through jump hosts: %v", err)
+		return
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte(msg)); err != nil {
+		t.Errorf("failed to write: %v", err)
+		return
+	}
+	buf := make([]byte, len(msg))
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		t.Errorf("failed to read: %v", err)
+		return
+	}
+	if string(buf) != msg {
+		t.Errorf("got %q want %q", buf, msg)
+	}
+}
+
+func TestParseHops(t *testing.T) {
+	got, err := ParseHops("admin@bastion, bastion2:2222,ops@[::1]:22", "me")
+	if err != nil {
+		t.Fatalf("failed to parse: %v", err)
+	}
+	want := []Hop{{"admin", "bastion:22"}, {"me", "bastion2:2222"}, {"ops", "[::1]:22"}}
+	if diff := deep.Equal(got, want); diff != nil {
+		t.Error(diff)
+	}
+
+	for _, spec := range []string{"", "admin@", ","} {
+		if _, err := ParseHops(spec, "me"); err == nil {
+			t.Errorf("ParseHops(%q): expected an error", spec)
+		}
+	}
+}
+
+func TestPool(t *testing.T) {
+	first := startBastion(t)
+	second := startBastion(t)
+	echo := startEcho(t)
+
+	hops := []Hop{{"jumper", first.addr}, {"jumper", second.addr}}
+	var d net.Dialer
+	p := NewPool(hops, []ssh.AuthMethod{ssh.Password("secret")}, d.DialContext)
+	defer p.Close()
+
+	// Concurrent connections share the connections to the jump hosts.
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			echoThrough(t, p, echo, "hello")
+		}()
+	}
+	wg.Wait()
+	if got := atomic.LoadInt32(&first.logins); got != 1 {
+		t.Errorf("got %d logins on the first jump host, want 1", got)
+	}
+	if got := atomic.LoadInt32(&second.logins); got != 1 {
+		t.Errorf("got %d logins on the second jump host, want 1", got)
+	}
+
+	// A broken jump host connection is reopened.
+	first.kill()
+	echoThrough(t, p, echo, "again")
+	if got := atomic.LoadInt32(&first.logins); got != 2 {
+		t.Errorf("got %d logins on the first jump host after it broke, want 2", got)
+	}
+}
+
+func TestPoolBadPassword(t *testing.T) {
+	b := startBastion(t)
+	var d net.Dialer
+	p := NewPool([]Hop{{"jumper", b.addr}}, []ssh.AuthMethod{ssh.Password("wrong")}, d.DialContext)
+	defer p.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := p.Dial(ctx, "tcp", "127.0.0.1:1"); err == nil {
+		t.Errorf("expected an error logging in with a wrong password")
+	}
+}
+
+func TestViaSharesAgentConnection(t *testing.T) {
+	sock := t.TempDir() + "/agent.sock"
+	l, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer l.Close()
+	conns := make(chan net.Conn, 10)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conns <- conn
+		}
+	}()
+	t.Setenv("SSH_AUTH_SOCK", sock)
+
+	var d net.Dialer
+	for i := 0; i < 3; i++ {
+		if _, err := Via("jumper@agent-test:22", "me", "secret", d.DialContext); err != nil {
+			t.Fatalf("Via failed: %v", err)
+		}
+	}
+	poolsMu.Lock()
+	p := pools["jumper@agent-test:22"]
+	delete(pools, "jumper@agent-test:22")
+	poolsMu.Unlock()
+
+	// Only the call that made the pool connects to the agent, and closing the pool closes that connection.
+	conn := <-conns
+	select {
+	case <-conns:
+		t.Errorf("more than one connection to the agent")
+	case <-time.After(100 * time.Millisecond):
+	}
+	p.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("got %v reading from the agent connection after closing the pool, want EOF", err)
+	}
+}
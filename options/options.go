@@ -4,6 +4,9 @@ import (
 	"context"
 	"net"
 	"time"
+
+	"github.com/cdevr/cpush/credentials"
+	"github.com/cdevr/cpush/sshconfig"
 )
 
 type Dialer func(ctx context.Context, network string, addr string) (net.Conn, error)
@@ -15,6 +18,16 @@ type Options struct {
 	SuppressOutput  bool
 	Timeout         time.Duration
 	Dialer          Dialer
+	// SSHConfig is the OpenSSH client configuration to look devices up in. It's not used when it's nil.
+	SSHConfig *sshconfig.Config
+	// Credentials returns the credential of a device by its name. It's asked when no password is given. See
+	// credentials.PerDevice.
+	Credentials credentials.Provider
+	// LogDir is the directory to write a transcript of every session with a device to, see package transcript. No
+	// transcripts are written when it's empty.
+	LogDir string
+	// Operator is the user that runs the sessions, for transcripts. It's the current user when it's empty.
+	Operator string
 }
 
 func NewOptions() *Options {
@@ -26,3 +39,17 @@ func NewOptions() *Options {
 func (o *Options) Dial(ctx context.Context, network string, addr string) (net.Conn, error) {
 	return o.Dialer(ctx, network, addr)
 }
+
+type deviceKey struct{}
+
+// WithDevice returns a context that tells the dialer which device it dials. The address it gets might not have the
+// device name anymore, for example when the ssh config gives the device a HostName.
+func WithDevice(ctx context.Context, device string) context.Context {
+	return context.WithValue(ctx, deviceKey{}, device)
+}
+
+// DeviceFrom returns the device of a context made with WithDevice, or "" if there is none.
+func DeviceFrom(ctx context.Context) string {
+	device, _ := ctx.Value(deviceKey{}).(string)
+	return device
+}
@@ -2,6 +2,7 @@ package pwcache
 
 import (
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"log"
 	"os"
@@ -21,7 +22,7 @@ func GetPassword(clearCache bool, usePwCache bool) (string, error) {
 
 	if clearCache {
 		err := os.Remove(fn)
-		if err != nil {
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
 			return "", fmt.Errorf("failed to delete password cache in %q: %w", fn, err)
 		}
 	}
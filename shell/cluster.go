@@ -0,0 +1,343 @@
+package shell
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/cdevr/cpush/cisco"
+	"github.com/cdevr/cpush/options"
+	"github.com/cdevr/cpush/transcript"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/term"
+)
+
+// clusterIDs are the keys that select the devices of a cluster shell in escape sequences, so there can be as many
+// devices as there are keys.
+const clusterIDs = "123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+
+// clusterHelp lists the escape sequences of a cluster shell, with \r\n since the terminal is in raw mode.
+const clusterHelp = "\r\nSupported escape sequences:\r\n" +
+	" ~.   - terminate all connections\r\n" +
+	" ~l   - list the devices, and whether they get what is typed\r\n" +
+	" ~N   - mute or unmute device N, so it doesn't get what is typed\r\n" +
+	" ~fN  - focus on device N, so only it gets what is typed\r\n" +
+	" ~a   - send what is typed to all unmuted devices again\r\n" +
+	" ~?   - this message\r\n" +
+	" ~~   - send the escape character by typing it twice\r\n" +
+	"(Note that escapes are only recognized immediately after newline.)\r\n"
+
+// clusterMember is a device of a cluster shell.
+type clusterMember struct {
+	id      byte
+	device  string
+	conn    *cisco.Client
+	session *ssh.Session
+	stdin   io.Writer
+	rec     *transcript.Recorder
+
+	muted  bool
+	closed bool
+}
+
+// cluster is a remote shell on many devices, like cluster SSH.
+type cluster struct {
+	out *mux
+
+	mu      sync.Mutex
+	members []*clusterMember
+	// focus is the member that alone gets what is typed, -1 if all unmuted members get it.
+	focus int
+}
+
+// Cluster starts remote shells on many devices and connects them all to the terminal, like csshX or tmux with
+// synchronize-panes. What is typed is sent to all devices, and their output is shown line by line, prefixed by the
+// device. Devices can be muted, or one device can be focused on to type on it alone, see clusterHelp. Devices that
+// can't be connected to are skipped. It returns when all sessions are closed, or the context is done.
+func Cluster(ctx context.Context, opts *options.Options, devices []string, username func(device string) string, password string) error {
+	if len(devices) > len(clusterIDs) {
+		return fmt.Errorf("can't open interactive shells on %d devices, at most %d", len(devices), len(clusterIDs))
+	}
+	log.Printf("starting interactive shells on %d devices", len(devices))
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	nameWidth := 0
+	for _, d := range devices {
+		if len(d) > nameWidth {
+			nameWidth = len(d)
+		}
+	}
+	var prefixes []string
+	for i, d := range devices {
+		prefixes = append(prefixes, fmt.Sprintf("%c %-*s | ", clusterIDs[i], nameWidth, d))
+	}
+	c := &cluster{out: newMux(os.Stdout, prefixes), focus: -1}
+	defer c.out.stop()
+
+	width, height := terminalSize()
+	termType := terminalType()
+	ptyWidth := func(w int) int {
+		if w -= len(prefixes[0]); w < 20 {
+			return 20
+		}
+		return w
+	}
+
+	// Connect to all devices at once, before the terminal is set to raw mode, in case a password has to be asked.
+	members := make([]*clusterMember, len(devices))
+	errs := make([]error, len(devices))
+	var wg sync.WaitGroup
+	for i, d := range devices {
+		wg.Add(1)
+		go func(i int, d string) {
+			defer wg.Done()
+			members[i], errs[i] = c.start(ctx, opts, i, d, username(d), password, termType, ptyWidth(width), height)
+		}(i, d)
+	}
+	wg.Wait()
+	for i, m := range members {
+		if errs[i] != nil {
+			fmt.Fprintf(os.Stderr, "skipping device %q: %v\n", devices[i], errs[i])
+			continue
+		}
+		c.members = append(c.members, m)
+	}
+	defer func() {
+		for _, m := range c.members {
+			m.session.Close()
+			m.conn.Close()
+			m.rec.Close()
+		}
+	}()
+	if len(c.members) == 0 {
+		return fmt.Errorf("failed to open an interactive shell on any device")
+	}
+
+	// Set the terminal to raw mode so single keys work.
+	oldTerminalState, err := term.MakeRaw(int(os.Stdin.Fd()))
+	if err != nil {
+		return fmt.Errorf("failed to set Terminal to raw mode: %v", err)
+	}
+	defer term.Restore(int(os.Stdin.Fd()), oldTerminalState)
+
+	c.out.notice(fmt.Sprintf("typing goes to %d devices, ~? for help", len(c.members)))
+
+	// Tell the devices when the terminal is resized.
+	winch := make(chan os.Signal, 1)
+	signal.Notify(winch, syscall.SIGWINCH)
+	defer signal.Stop(winch)
+	go func() {
+		for {
+			select {
+			case <-winch:
+				w, h := terminalSize()
+				if w == width && h == height {
+					continue
+				}
+				width, height = w, h
+				for _, m := range c.members {
+					m.session.WindowChange(h, ptyWidth(w))
+					m.rec.Resize(ptyWidth(w), h)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var closed sync.WaitGroup
+	for _, m := range c.members {
+		closed.Add(1)
+		go func(m *clusterMember) {
+			defer closed.Done()
+			m.session.Wait()
+			c.mu.Lock()
+			m.closed = true
+			c.mu.Unlock()
+			c.out.notice(fmt.Sprintf("connection to %s closed", m.device))
+		}(m)
+	}
+	allClosed := make(chan struct{})
+	go func() {
+		closed.Wait()
+		close(allClosed)
+	}()
+
+	// ~. disconnects all devices by cancelling the context.
+	stdin := newEscapeReader(os.Stdin, nil, "", cancel)
+	stdin.help = func() { c.out.print(clusterHelp) }
+	stdin.command = c.command
+	go func() {
+		buf := make([]byte, 1024)
+		for {
+			n, err := stdin.Read(buf)
+			c.broadcast(buf[:n])
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	select {
+	case <-allClosed:
+	case <-ctx.Done():
+		// The connections are closed when the context is done, which ends the sessions.
+		<-allClosed
+	}
+	return nil
+}
+
+// start opens a remote shell on a device of the cluster, with its output going to the terminal.
+func (c *cluster) start(ctx context.Context, opts *options.Options, i int, device string, username string, password string, termType string, width, height int) (*clusterMember, error) {
+	conn, err := cisco.Dial(ctx, opts, device, username, password)
+	if err != nil {
+		return nil, err
+	}
+	m := &clusterMember{id: clusterIDs[i], device: device, conn: conn}
+	fail := func(err error) (*clusterMember, error) {
+		if m.session != nil {
+			m.session.Close()
+		}
+		conn.Close()
+		m.rec.Close()
+		return nil, err
+	}
+
+	m.session, err = conn.NewSession()
+	if err != nil {
+		return fail(fmt.Errorf("failed to get session on device %q: %v", device, err))
+	}
+	if err := m.session.RequestPty(termType, height, width, ptyModes); err != nil {
+		return fail(fmt.Errorf("failed to get pty on device %q: %v", device, err))
+	}
+	m.rec, err = transcript.Create(opts.LogDir, transcript.Header{
+		Width:     width,
+		Height:    height,
+		Env:       map[string]string{"TERM": termType},
+		Device:    device,
+		Operator:  opts.Operator,
+		Operation: "interactive",
+	})
+	if err != nil {
+		return fail(err)
+	}
+	stdin, err := m.session.StdinPipe()
+	if err != nil {
+		return fail(fmt.Errorf("failed to get stdin on device %q: %v", device, err))
+	}
+	m.stdin = m.rec.Input(stdin)
+	m.session.Stdout = m.rec.Output(c.out.writer(i))
+	m.session.Stderr = m.rec.Output(c.out.writer(i))
+
+	if err := m.session.Shell(); err != nil {
+		return fail(fmt.Errorf("failed to get shell on device %q: %v", device, err))
+	}
+	return m, nil
+}
+
+// broadcast sends what is typed to the focused device, or to all unmuted devices.
+func (c *cluster) broadcast(p []byte) {
+	if len(p) == 0 {
+		return
+	}
+	c.mu.Lock()
+	var targets []*clusterMember
+	for i, m := range c.members {
+		if m.closed || (c.focus >= 0 && c.focus != i) || (c.focus < 0 && m.muted) {
+			continue
+		}
+		targets = append(targets, m)
+	}
+	c.mu.Unlock()
+
+	// Writing can block while a device doesn't read, so that's done without holding the lock.
+	for _, m := range targets {
+		m.stdin.Write(p)
+	}
+}
+
+// command handles the escape sequences of the cluster, see clusterHelp.
+func (c *cluster) command(seq []byte) escapeResult {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch {
+	case seq[0] == 'l':
+		c.out.print(c.list())
+		return escapeDone
+	case seq[0] == 'a':
+		c.focus = -1
+		for _, m := range c.members {
+			m.muted = false
+		}
+		c.out.notice("typing goes to all devices")
+		return escapeDone
+	case seq[0] == 'f' && len(seq) == 1:
+		return escapeMore
+	case seq[0] == 'f':
+		i := c.find(seq[1])
+		if i < 0 {
+			c.out.notice(fmt.Sprintf("no device %c", seq[1]))
+			return escapeDone
+		}
+		c.focus = i
+		c.out.notice(fmt.Sprintf("typing goes to %s only, ~a to go back to all", c.members[i].device))
+		return escapeDone
+	case strings.IndexByte(clusterIDs, seq[0]) >= 0:
+		i := c.find(seq[0])
+		if i < 0 {
+			c.out.notice(fmt.Sprintf("no device %c", seq[0]))
+			return escapeDone
+		}
+		m := c.members[i]
+		m.muted = !m.muted
+		if m.muted {
+			c.out.notice(fmt.Sprintf("%s is muted", m.device))
+		} else {
+			c.out.notice(fmt.Sprintf("%s is unmuted", m.device))
+		}
+		if c.focus >= 0 {
+			c.out.notice(fmt.Sprintf("typing still goes to %s only, ~a to go back to all", c.members[c.focus].device))
+		}
+		return escapeDone
+	}
+	return notEscape
+}
+
+// find returns the index of the member with an id, or -1. The caller must hold the lock.
+func (c *cluster) find(id byte) int {
+	for i, m := range c.members {
+		if m.id == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// list describes the devices and whether they get what is typed. The caller must hold the lock.
+func (c *cluster) list() string {
+	var b strings.Builder
+	b.WriteString("\r\nDevices:\r\n")
+	for i, m := range c.members {
+		state := "typing"
+		switch {
+		case m.closed:
+			state = "closed"
+		case c.focus >= 0 && c.focus == i:
+			state = "focused"
+		case c.focus >= 0:
+			state = "not focused"
+		case m.muted:
+			state = "muted"
+		}
+		fmt.Fprintf(&b, " %c  %s (%s)\r\n", m.id, m.device, state)
+	}
+	return b.String()
+}
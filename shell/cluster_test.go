@@ -0,0 +1,42 @@
+package shell
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestClusterTyping(t *testing.T) {
+	var out bytes.Buffer
+	c := &cluster{out: newMux(&out, []string{"1 a | ", "2 b | ", "3 c | "}), focus: -1}
+	defer c.out.stop()
+	typed := map[string]*bytes.Buffer{}
+	for i, d := range []string{"a", "b", "c"} {
+		typed[d] = &bytes.Buffer{}
+		c.members = append(c.members, &clusterMember{id: clusterIDs[i], device: d, stdin: typed[d]})
+	}
+
+	e := newEscapeReader(&oneByteReader{strings.NewReader("x\r~2y\r~f3z\r~fQ~aw\r~l")}, io.Discard, "", func() {})
+	e.command = c.command
+	buf := make([]byte, 16)
+	for {
+		n, err := e.Read(buf)
+		c.broadcast(buf[:n])
+		if err != nil {
+			break
+		}
+	}
+
+	// b is muted for y, and only c has the focus for z. ~a goes back to all devices, unmuting b.
+	for d, want := range map[string]string{"a": "x\ry\rw\r", "b": "x\rw\r", "c": "x\ry\rz\rw\r"} {
+		if got := typed[d].String(); got != want {
+			t.Errorf("device %s got %q, want %q", d, got, want)
+		}
+	}
+	for _, want := range []string{"b is muted", "typing goes to c only", "no device Q", " 2  b (typing)"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output %q doesn't contain %q", out.String(), want)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package shell
+
+import (
+	"io"
+)
+
+// escapeHelp lists the escape sequences, with \r\n since the terminal is in raw mode.
+const escapeHelp = "\r\nSupported escape sequences:\r\n" +
+	" ~.   - terminate connection\r\n" +
+	" ~?   - this message\r\n" +
+	" ~~   - send the escape character by typing it twice\r\n" +
+	"(Note that escapes are only recognized immediately after newline.)\r\n"
+
+// escapeResult is what an escape command made of the characters typed after a ~.
+type escapeResult int
+
+const (
+	// notEscape means the characters aren't an escape sequence, so they're sent with the ~.
+	notEscape escapeResult = iota
+	// escapeDone means the characters were an escape sequence, and it was handled.
+	escapeDone
+	// escapeMore means the characters are the start of an escape sequence.
+	escapeMore
+)
+
+// escapeReader handles OpenSSH-style escape sequences in what is typed, before it's sent to the device. A ~ right
+// after a newline starts an escape sequence: ~. disconnects, ~? shows help, ~~ sends a single ~.
+type escapeReader struct {
+	rd io.Reader
+	// help shows the help.
+	help func()
+	// disconnect is called when ~. is typed.
+	disconnect func()
+	// command handles other escape sequences, if it's set. It's called with the characters typed after the ~.
+	command func(seq []byte) escapeResult
+
+	// newline is true if the last character was a newline, or nothing was typed yet.
+	newline bool
+	// escaping is true while an escape sequence is typed, seq holds the characters after the ~.
+	escaping bool
+	seq      []byte
+	// buf holds the characters that are ready to be sent.
+	buf  []byte
+	done bool
+	err  error
+}
+
+// newEscapeReader returns a reader that shows help by writing helpText to w.
+func newEscapeReader(rd io.Reader, w io.Writer, helpText string, disconnect func()) *escapeReader {
+	return &escapeReader{
+		rd:         rd,
+		help:       func() { io.WriteString(w, helpText) },
+		disconnect: disconnect,
+		newline:    true,
+	}
+}
+
+func (e *escapeReader) Read(p []byte) (int, error) {
+	for len(e.buf) == 0 {
+		if e.done {
+			return 0, io.EOF
+		}
+		if e.err != nil {
+			return 0, e.err
+		}
+		in := make([]byte, len(p))
+		n, err := e.rd.Read(in)
+		e.err = err
+		e.process(in[:n])
+	}
+	n := copy(p, e.buf)
+	e.buf = e.buf[n:]
+	return n, nil
+}
+
+func (e *escapeReader) process(in []byte) {
+	for _, c := range in {
+		if e.escaping {
+			e.seq = append(e.seq, c)
+			result := notEscape
+			switch {
+			case len(e.seq) == 1 && c == '.':
+				e.done = true
+				e.buf = nil
+				e.disconnect()
+				return
+			case len(e.seq) == 1 && c == '?':
+				e.help()
+				result = escapeDone
+			case len(e.seq) == 1 && c == '~':
+				e.buf = append(e.buf, '~')
+				e.escaping = false
+				e.newline = false
+				continue
+			case e.command != nil:
+				result = e.command(e.seq)
+			}
+			switch result {
+			case escapeMore:
+				continue
+			case escapeDone:
+				// Another escape sequence can follow right away.
+				e.escaping = false
+				e.newline = true
+				continue
+			}
+			// Not an escape sequence, so the ~ is sent after all.
+			e.escaping = false
+			e.buf = append(e.buf, '~')
+			e.buf = append(e.buf, e.seq...)
+			e.newline = c == '\r' || c == '\n'
+			continue
+		}
+		if c == '~' && e.newline {
+			e.escaping = true
+			e.seq = e.seq[:0]
+			continue
+		}
+		e.buf = append(e.buf, c)
+		e.newline = c == '\r' || c == '\n'
+	}
+}
@@ -0,0 +1,56 @@
+package shell
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestEscapeReader(t *testing.T) {
+	for _, test := range []struct {
+		name       string
+		typed      string
+		want       string
+		disconnect bool
+		help       bool
+	}{
+		{"plain", "show clock\r", "show clock\r", false, false},
+		{"tilde mid line", "echo a~.b\r", "echo a~.b\r", false, false},
+		{"disconnect at start", "~.show clock\r", "", true, false},
+		{"disconnect after newline", "show clock\r~.exit\r", "show clock\r", true, false},
+		{"double tilde", "\r~~.\r", "\r~.\r", false, false},
+		{"not an escape", "~x\r", "~x\r", false, false},
+		{"help", "~?~.", "", true, true},
+	} {
+		var help bytes.Buffer
+		disconnected := false
+		// Feed one byte at a time, to catch state that doesn't survive between reads.
+		e := newEscapeReader(&oneByteReader{strings.NewReader(test.typed)}, &help, escapeHelp, func() { disconnected = true })
+		got, err := io.ReadAll(e)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if string(got) != test.want {
+			t.Errorf("%s: sent %q, want %q", test.name, got, test.want)
+		}
+		if disconnected != test.disconnect {
+			t.Errorf("%s: disconnected is %v, want %v", test.name, disconnected, test.disconnect)
+		}
+		if (help.Len() > 0) != test.help {
+			t.Errorf("%s: help shown is %v, want %v", test.name, help.Len() > 0, test.help)
+		}
+	}
+}
+
+type oneByteReader struct {
+	r io.Reader
+}
+
+func (o *oneByteReader) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	return o.r.Read(p[:1])
+}
@@ -0,0 +1,139 @@
+package shell
+
+import (
+	"bytes"
+	"io"
+	"sync"
+	"time"
+)
+
+// muxIdle is how long the unfinished line of a device, like its prompt, waits for more output before it's shown.
+const muxIdle = 200 * time.Millisecond
+
+// mux shows the output of many devices on one terminal, every line prefixed by its device. Lines are shown when they're
+// complete, or when the device has been quiet for a while, so the output of devices isn't mixed up within a line. It's
+// safe for concurrent use.
+type mux struct {
+	w io.Writer
+	// idle is how long an unfinished line waits before it's shown.
+	idle time.Duration
+
+	mu      sync.Mutex
+	devices []*muxDevice
+	// open is the device whose line the cursor is on, -1 if the cursor is at the start of a line.
+	open int
+}
+
+type muxDevice struct {
+	prefix string
+	// line is the unfinished line, of which shown bytes are on the terminal.
+	line  []byte
+	shown int
+	timer *time.Timer
+}
+
+func newMux(w io.Writer, prefixes []string) *mux {
+	m := &mux{w: w, idle: muxIdle, open: -1}
+	for _, p := range prefixes {
+		m.devices = append(m.devices, &muxDevice{prefix: p})
+	}
+	return m
+}
+
+// writer returns the writer for the output of device i.
+func (m *mux) writer(i int) io.Writer {
+	return muxWriter{m, i}
+}
+
+type muxWriter struct {
+	m *mux
+	i int
+}
+
+func (w muxWriter) Write(p []byte) (int, error) {
+	w.m.write(w.i, p)
+	return len(p), nil
+}
+
+func (m *mux) write(i int, p []byte) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	d := m.devices[i]
+	for _, c := range p {
+		// Lines are ended with \r\n when they're shown, a lone \r would overwrite the prefix.
+		if c == '\r' {
+			continue
+		}
+		d.line = append(d.line, c)
+		if c == '\n' {
+			m.show(i)
+		}
+	}
+	if len(d.line) > d.shown {
+		if d.timer == nil {
+			d.timer = time.AfterFunc(m.idle, func() { m.flush(i) })
+		} else {
+			d.timer.Reset(m.idle)
+		}
+	}
+}
+
+// flush shows the unfinished line of device i.
+func (m *mux) flush(i int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.devices[i].line) > m.devices[i].shown {
+		m.show(i)
+	}
+}
+
+// show writes the line of device i to the terminal. If the cursor is still on its line, only what's new is written,
+// otherwise the whole line is written on a new line. The caller must hold the lock.
+func (m *mux) show(i int) {
+	d := m.devices[i]
+	var b bytes.Buffer
+	if m.open == i {
+		b.Write(d.line[d.shown:])
+	} else {
+		if m.open >= 0 {
+			b.WriteString("\n")
+		}
+		b.WriteString(d.prefix)
+		b.Write(d.line)
+	}
+	m.open = i
+	d.shown = len(d.line)
+	if bytes.HasSuffix(d.line, []byte("\n")) {
+		m.open = -1
+		d.line = d.line[:0]
+		d.shown = 0
+	}
+	m.w.Write(bytes.ReplaceAll(b.Bytes(), []byte("\n"), []byte("\r\n")))
+}
+
+// notice shows a message of cpush itself on a line of its own.
+func (m *mux) notice(msg string) {
+	m.print("*** " + msg + "\r\n")
+}
+
+// print writes text of cpush itself, starting on a new line.
+func (m *mux) print(text string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.open >= 0 {
+		io.WriteString(m.w, "\r\n")
+		m.open = -1
+	}
+	io.WriteString(m.w, text)
+}
+
+// stop stops showing unfinished lines later.
+func (m *mux) stop() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, d := range m.devices {
+		if d.timer != nil {
+			d.timer.Stop()
+		}
+	}
+}
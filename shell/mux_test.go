@@ -0,0 +1,40 @@
+package shell
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestMux(t *testing.T) {
+	var out bytes.Buffer
+	m := newMux(&out, []string{"A | ", "B | "})
+	// Unfinished lines are only shown when flushed below.
+	m.idle = time.Hour
+	defer m.stop()
+
+	m.write(0, []byte("a1\r\nrtr1#"))
+	m.write(1, []byte("b1\r\n"))
+	m.flush(0)
+	// The cursor is still on the line of A, so it's continued.
+	m.write(0, []byte("show\r\n"))
+	m.write(1, []byte("rtr2#"))
+	m.flush(1)
+	// B's line is open, so A starts a new line.
+	m.write(0, []byte("x"))
+	m.flush(0)
+	m.notice("bye")
+	// A's line was interrupted, so it's shown again in full.
+	m.write(0, []byte("y\n"))
+
+	want := "A | a1\r\n" +
+		"B | b1\r\n" +
+		"A | rtr1#show\r\n" +
+		"B | rtr2#\r\n" +
+		"A | x\r\n" +
+		"*** bye\r\n" +
+		"A | xy\r\n"
+	if got := out.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -5,63 +5,52 @@ import (
 	"fmt"
 	"log"
 	"os"
-	"strings"
+	"os/signal"
+	"syscall"
 
+	"github.com/cdevr/cpush/cisco"
 	"github.com/cdevr/cpush/options"
+	"github.com/cdevr/cpush/transcript"
 
 	"golang.org/x/crypto/ssh"
 	"golang.org/x/term"
 )
 
-func respondInteractive(password string) func(user, instruction string, questions []string, echos []bool) ([]string, error) {
-	return func(user, instruction string, questions []string, echos []bool) ([]string, error) {
-		var answers []string
-		for range questions {
-			answers = append(answers, password)
-		}
-		return answers, nil
-	}
+// ptyModes are the terminal modes of the remote shells.
+var ptyModes = ssh.TerminalModes{
+	ssh.ECHO:          1,
+	ssh.TTY_OP_ISPEED: 14400,
+	ssh.TTY_OP_OSPEED: 14400,
 }
 
-// sshConfig returns additional ssh configuration options for cisco routers, such as allowing bad ciphers used by Cisco.
-func sshConfig() ssh.Config {
-	extraCiphers := []string{"aes128-cbc", "3des-cbc", "aes192-cbc", "aes256-cbc"}
-
-	config := ssh.Config{}
-	config.SetDefaults()
-
-	config.Ciphers = append(config.Ciphers, extraCiphers...)
-
-	return config
+// terminalSize returns the size of the terminal, or 80x50 if it's not a terminal.
+func terminalSize() (width int, height int) {
+	width, height, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil {
+		return 80, 50
+	}
+	return width, height
 }
 
-// Interactive starts a remote shell and connects it to the terminal.
-func Interactive(opts *options.Options, device string, username string, password string) error {
-	log.Printf("starting interactive shell")
-	config := &ssh.ClientConfig{
-		User: username,
-		Auth: []ssh.AuthMethod{
-			ssh.Password(password),
-			ssh.KeyboardInteractive(respondInteractive(password)),
-		},
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
-		Config:          sshConfig(),
+// terminalType returns the user's terminal type, to use on the devices like ssh does.
+func terminalType() string {
+	if t := os.Getenv("TERM"); t != "" {
+		return t
 	}
+	return "xterm"
+}
 
-	addr := device
-	if !strings.Contains(addr, ":") {
-		addr = addr + ":22"
-	}
+// Interactive starts a remote shell and connects it to the terminal. The session is closed when the context is done.
+// The credentials and the ssh config of the device are used like for cisco.Cmd, see cisco.Dial.
+func Interactive(ctx context.Context, opts *options.Options, device string, username string, password string) error {
+	log.Printf("starting interactive shell")
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
 
-	tcpconn, err := opts.Dial(context.Background(), "tcp", addr)
+	conn, err := cisco.Dial(ctx, opts, device, username, password)
 	if err != nil {
-		return fmt.Errorf("failed to connect to device %q as user %q: %v", device, username, err)
+		return err
 	}
-	sshconn, chans, reqs, err := ssh.NewClientConn(tcpconn, addr, config)
-	if err != nil {
-		return fmt.Errorf("failed to connect to device %q as user %q: %v", device, username, err)
-	}
-	conn := ssh.NewClient(sshconn, chans, reqs)
 	defer conn.Close()
 
 	session, err := conn.NewSession()
@@ -70,13 +59,24 @@ func Interactive(opts *options.Options, device string, username string, password
 	}
 	defer session.Close()
 
-	modes := ssh.TerminalModes{
-		ssh.ECHO: 0,
+	width, height := terminalSize()
+	termType := terminalType()
+	if err := session.RequestPty(termType, height, width, ptyModes); err != nil {
+		return fmt.Errorf("failed to get pty on device %q: %v", device, err)
 	}
 
-	if err := session.RequestPty("xterm", 50, 80, modes); err != nil {
-		return fmt.Errorf("failed to get pty on device %q: %v", device, err)
+	rec, err := transcript.Create(opts.LogDir, transcript.Header{
+		Width:     width,
+		Height:    height,
+		Env:       map[string]string{"TERM": termType},
+		Device:    device,
+		Operator:  opts.Operator,
+		Operation: "interactive",
+	})
+	if err != nil {
+		return err
 	}
+	defer rec.Close()
 
 	// Set the terminal to raw mode so single keys work.
 	oldTerminalState, err := term.MakeRaw(int(os.Stdin.Fd()))
@@ -85,13 +85,45 @@ func Interactive(opts *options.Options, device string, username string, password
 	}
 	defer term.Restore(int(os.Stdin.Fd()), oldTerminalState)
 
-	session.Stdin = os.Stdin
-	session.Stderr = os.Stderr
-	session.Stdout = os.Stdout
+	// Tell the device when the terminal is resized.
+	winch := make(chan os.Signal, 1)
+	signal.Notify(winch, syscall.SIGWINCH)
+	defer signal.Stop(winch)
+	go func() {
+		for {
+			select {
+			case <-winch:
+				w, h := terminalSize()
+				if w == width && h == height {
+					continue
+				}
+				width, height = w, h
+				session.WindowChange(h, w)
+				rec.Resize(w, h)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	// ~. disconnects, which closes the connection by cancelling the context.
+	disconnected := false
+	stdin := newEscapeReader(os.Stdin, os.Stderr, escapeHelp, func() {
+		disconnected = true
+		cancel()
+	})
+	session.Stdin = rec.InputReader(stdin)
+	session.Stderr = rec.Output(os.Stderr)
+	session.Stdout = rec.Output(os.Stdout)
 
 	if err := session.Shell(); err != nil {
 		return fmt.Errorf("failed to get shell on device %q: %v", device, err)
 	}
 
-	return session.Wait()
+	err = session.Wait()
+	if disconnected {
+		fmt.Fprintf(os.Stderr, "\r\nConnection to %s closed.\r\n", device)
+		return nil
+	}
+	return err
 }
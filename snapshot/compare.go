@@ -0,0 +1,145 @@
+package snapshot
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/cdevr/cpush/checks"
+	"github.com/cdevr/cpush/utils"
+)
+
+func isUp(r Record) bool {
+	return r.Field("link_status") == "up" && r.Field("protocol_status") == "up"
+}
+
+func compareInterfaces(device string, pre []Record, post []Record, opts CompareOptions) []checks.CheckResult {
+	var results []checks.CheckResult
+
+	checkName := "CompareInterfaces"
+
+	postByName := byKey(post, "interface")
+	preByName := byKey(pre, "interface")
+	for _, intf := range utils.SortedKeys(preByName) {
+		before := preByName[intf]
+		after, ok := postByName[intf]
+		if !ok {
+			results = append(results, checks.CheckResult{
+				CheckName: checkName,
+				Device:    device,
+				Result:    fmt.Sprintf("%s: interface disappeared", intf),
+				Severity:  checks.Warning,
+				Fields:    map[string]string{"interface": intf},
+			})
+			continue
+		}
+
+		switch {
+		case isUp(before) && !isUp(after):
+			results = append(results, checks.CheckResult{
+				CheckName: checkName,
+				Device:    device,
+				Result:    fmt.Sprintf("%s: went down, admin %q protocol %q", intf, after.Field("link_status"), after.Field("protocol_status")),
+				Severity:  checks.Critical,
+				Fields:    map[string]string{"interface": intf, "link_status": after.Field("link_status"), "protocol_status": after.Field("protocol_status")},
+			})
+		case !isUp(before) && isUp(after):
+			results = append(results, checks.CheckResult{
+				CheckName: checkName,
+				Device:    device,
+				Result:    fmt.Sprintf("%s: came up", intf),
+				Severity:  checks.Info,
+				Fields:    map[string]string{"interface": intf, "link_status": after.Field("link_status"), "protocol_status": after.Field("protocol_status")},
+			})
+		}
+
+		counters := []struct {
+			name        string
+			description string
+		}{
+			{"crc", "CRC errors"},
+			{"input_errors", "input errors"},
+			{"output_errors", "output errors"},
+		}
+		for _, c := range counters {
+			beforeCount, err1 := strconv.Atoi(before.Field(c.name))
+			afterCount, err2 := strconv.Atoi(after.Field(c.name))
+			// Counters that went down were cleared, that's not an increase.
+			if err1 != nil || err2 != nil || afterCount <= beforeCount {
+				continue
+			}
+			results = append(results, checks.CheckResult{
+				CheckName: checkName,
+				Device:    device,
+				Result:    fmt.Sprintf("%s: %s increased from %d to %d", intf, c.description, beforeCount, afterCount),
+				Severity:  checks.Warning,
+				Fields:    map[string]string{"interface": intf, "counter": c.name, "before": before.Field(c.name), "after": after.Field(c.name)},
+			})
+		}
+	}
+	return results
+}
+
+func compareBgpSum(device string, pre []Record, post []Record, opts CompareOptions) []checks.CheckResult {
+	var results []checks.CheckResult
+
+	checkName := "CompareBgpSum"
+
+	postByNeighbor := byKey(post, "RemoteIP")
+	preByNeighbor := byKey(pre, "RemoteIP")
+	for _, neighbor := range utils.SortedKeys(preByNeighbor) {
+		before := preByNeighbor[neighbor]
+		after, ok := postByNeighbor[neighbor]
+		if !ok {
+			results = append(results, checks.CheckResult{
+				CheckName: checkName,
+				Device:    device,
+				Result:    fmt.Sprintf("%s: neighbor lost", neighbor),
+				Severity:  checks.Critical,
+				Fields:    map[string]string{"neighbor": neighbor},
+			})
+			continue
+		}
+
+		// Established neighbors have a prefix count instead of a state.
+		beforePfx, errBefore := strconv.Atoi(before.Field("Received_V4"))
+		afterPfx, errAfter := strconv.Atoi(after.Field("Received_V4"))
+		if errBefore != nil {
+			continue
+		}
+		if errAfter != nil {
+			results = append(results, checks.CheckResult{
+				CheckName: checkName,
+				Device:    device,
+				Result:    fmt.Sprintf("%s: neighbor went down, state %q", neighbor, after.Field("Status")),
+				Severity:  checks.Critical,
+				Fields:    map[string]string{"neighbor": neighbor, "status": after.Field("Status")},
+			})
+			continue
+		}
+		if beforePfx > 0 {
+			drop := 100.0 * float64(beforePfx-afterPfx) / float64(beforePfx)
+			if drop > opts.PrefixDropPercent {
+				results = append(results, checks.CheckResult{
+					CheckName: checkName,
+					Device:    device,
+					Result:    fmt.Sprintf("%s: received prefixes dropped %.1f%% from %d to %d", neighbor, drop, beforePfx, afterPfx),
+					Severity:  checks.Warning,
+					Fields:    map[string]string{"neighbor": neighbor, "before": before.Field("Received_V4"), "after": after.Field("Received_V4")},
+				})
+			}
+		}
+	}
+
+	for _, neighbor := range utils.SortedKeys(postByNeighbor) {
+		if _, ok := preByNeighbor[neighbor]; !ok {
+			results = append(results, checks.CheckResult{
+				CheckName: checkName,
+				Device:    device,
+				Result:    fmt.Sprintf("%s: new neighbor", neighbor),
+				Severity:  checks.Info,
+				Fields:    map[string]string{"neighbor": neighbor},
+			})
+		}
+	}
+	return results
+}
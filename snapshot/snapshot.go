@@ -0,0 +1,160 @@
+// Package snapshot stores the parsed state of devices, so the state before and after a change can be compared.
+package snapshot
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/cdevr/cpush/checks"
+	"github.com/cdevr/cpush/textfsm"
+	"github.com/cdevr/cpush/utils"
+)
+
+// Record is a single row parsed from command output by a TextFSM template.
+type Record map[string]interface{}
+
+// Field returns the value of a field in the record as a string. It returns "" if the field is not present.
+func (r Record) Field(name string) string {
+	if s, ok := r[name].(string); ok {
+		return s
+	}
+	return ""
+}
+
+// DeviceState contains the parsed records for every command that was executed on a device.
+type DeviceState map[string][]Record
+
+// Snapshot is the state of a set of devices at a point in time.
+type Snapshot struct {
+	Taken   time.Time              `json:"taken"`
+	Devices map[string]DeviceState `json:"devices"`
+}
+
+// Parsers maps the commands that can be stored in a snapshot to the TextFSM parser for their output.
+var Parsers = map[string]func(string) ([]map[string]interface{}, error){
+	"show interfaces":             textfsm.ParseCiscoIosShowInterfaces,
+	"show bgp sum":                textfsm.ParseCiscoIosShowBgpSummary,
+	"show bootvar":                textfsm.ParseCiscoIosShowBootvar,
+	"show bfd neighbors":          textfsm.ParseCiscoIosShowBfdNeighbor,
+	"show interfaces transceiver": textfsm.ParseCiscoIosShowInterfacesTransceiver,
+	"show license all":            textfsm.ParseCiscoIosShowLicenseAll,
+	"show standby":                textfsm.ParseCiscoIosShowStandby,
+}
+
+// New creates an empty snapshot.
+func New() *Snapshot {
+	return &Snapshot{
+		Taken:   time.Now(),
+		Devices: map[string]DeviceState{},
+	}
+}
+
+// Add parses the output of the commands executed on a device and stores it in the snapshot. Commands for which
+// there is no parser are ignored.
+func (s *Snapshot) Add(device string, cmdResults map[string]string) error {
+	state := DeviceState{}
+	for cmd, output := range cmdResults {
+		parse, ok := Parsers[cmd]
+		if !ok {
+			continue
+		}
+		rows, err := parse(output)
+		if err != nil {
+			return fmt.Errorf("failed to parse output of %q on %q: %v", cmd, device, err)
+		}
+		var records []Record
+		for _, row := range rows {
+			records = append(records, Record(row))
+		}
+		state[cmd] = records
+	}
+	s.Devices[device] = state
+	return nil
+}
+
+// Save writes the snapshot to a file as JSON.
+func (s *Snapshot) Save(fn string) error {
+	bts, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode snapshot: %v", err)
+	}
+	if err := os.WriteFile(fn, bts, 0666); err != nil {
+		return fmt.Errorf("failed to write snapshot to %q: %v", fn, err)
+	}
+	return nil
+}
+
+// Load reads a snapshot written by Save.
+func Load(fn string) (*Snapshot, error) {
+	bts, err := os.ReadFile(fn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshot %q: %v", fn, err)
+	}
+	s := New()
+	if err := json.Unmarshal(bts, s); err != nil {
+		return nil, fmt.Errorf("failed to decode snapshot %q: %v", fn, err)
+	}
+	return s, nil
+}
+
+// CompareOptions contains the thresholds used when comparing snapshots.
+type CompareOptions struct {
+	// PrefixDropPercent is how many percent the received prefixes of a BGP neighbor may drop before it's reported.
+	PrefixDropPercent float64
+}
+
+// A comparer reports the semantic differences between the records of a command before and after.
+type comparer func(device string, pre []Record, post []Record, opts CompareOptions) []checks.CheckResult
+
+var comparers = map[string]comparer{
+	"show interfaces": compareInterfaces,
+	"show bgp sum":    compareBgpSum,
+}
+
+// Compare reports the differences between two snapshots, as check results so they can be filtered and reported like
+// any other check. Only devices present in the pre snapshot are compared.
+func Compare(pre *Snapshot, post *Snapshot, opts CompareOptions) []checks.CheckResult {
+	var results []checks.CheckResult
+	for _, device := range utils.SortedKeys(pre.Devices) {
+		postState, ok := post.Devices[device]
+		if !ok {
+			results = append(results, checks.CheckResult{
+				CheckName: "Compare",
+				Device:    device,
+				Result:    "device missing from post snapshot",
+				Severity:  checks.Critical,
+			})
+			continue
+		}
+		preState := pre.Devices[device]
+		for _, cmd := range utils.SortedKeys(preState) {
+			compare, ok := comparers[cmd]
+			if !ok {
+				continue
+			}
+			if _, ok := postState[cmd]; !ok {
+				results = append(results, checks.CheckResult{
+					CheckName: "Compare",
+					Device:    device,
+					Result:    fmt.Sprintf("no output for %q in post snapshot", cmd),
+					Severity:  checks.Warning,
+					Fields:    map[string]string{"command": cmd},
+				})
+				continue
+			}
+			results = append(results, compare(device, preState[cmd], postState[cmd], opts)...)
+		}
+	}
+	return results
+}
+
+// byKey indexes records by the value of a field.
+func byKey(records []Record, field string) map[string]Record {
+	result := map[string]Record{}
+	for _, r := range records {
+		result[r.Field(field)] = r
+	}
+	return result
+}
@@ -0,0 +1,108 @@
+package snapshot
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/cdevr/cpush/checks"
+	"github.com/go-test/deep"
+)
+
+const bgpBefore = `BGP router identifier 192.0.2.70, local AS number 65550
+
+Neighbor        V    AS MsgRcvd MsgSent   TblVer  InQ OutQ Up/Down  State/PfxRcd
+192.0.2.77      4 65551    6965    1766        9    0    0  5w4d           1
+192.0.2.78      4 65552    6965    1766        9    0    0  5w4d          10
+192.0.2.79      4 65553    6965    1766        9    0    0  5w4d         100
+`
+
+const bgpAfter = `BGP router identifier 192.0.2.70, local AS number 65550
+
+Neighbor        V    AS MsgRcvd MsgSent   TblVer  InQ OutQ Up/Down  State/PfxRcd
+192.0.2.78      4 65552    6965    1766        9    0    0  00:01:02 Idle
+192.0.2.79      4 65553    6965    1766        9    0    0  5w4d          50
+192.0.2.80      4 65554    6965    1766        9    0    0  5w4d          10
+`
+
+const interfacesBefore = `GigabitEthernet0/1 is up, line protocol is up
+     0 input errors, 3 CRC, 0 frame, 0 overrun, 0 ignored
+GigabitEthernet0/2 is up, line protocol is up
+     0 input errors, 0 CRC, 0 frame, 0 overrun, 0 ignored
+`
+
+const interfacesAfter = `GigabitEthernet0/1 is up, line protocol is up
+     0 input errors, 7 CRC, 0 frame, 0 overrun, 0 ignored
+GigabitEthernet0/2 is up, line protocol is down
+     0 input errors, 0 CRC, 0 frame, 0 overrun, 0 ignored
+`
+
+func mustSnapshot(t *testing.T, device string, cmdResults map[string]string) *Snapshot {
+	s := New()
+	if err := s.Add(device, cmdResults); err != nil {
+		t.Fatalf("failed to add %q to snapshot: %v", device, err)
+	}
+	return s
+}
+
+func TestCompareBgpSum(t *testing.T) {
+	pre := mustSnapshot(t, "rtr1", map[string]string{"show bgp sum": bgpBefore})
+	post := mustSnapshot(t, "rtr1", map[string]string{"show bgp sum": bgpAfter})
+
+	var got []string
+	for _, r := range Compare(pre, post, CompareOptions{PrefixDropPercent: 10}) {
+		got = append(got, r.Severity.String()+" "+r.Result)
+	}
+	want := []string{
+		"critical 192.0.2.77: neighbor lost",
+		"critical 192.0.2.78: neighbor went down, state \"Idle\"",
+		"warning 192.0.2.79: received prefixes dropped 50.0% from 100 to 50",
+		"info 192.0.2.80: new neighbor",
+	}
+	if diff := deep.Equal(got, want); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestCompareInterfaces(t *testing.T) {
+	pre := mustSnapshot(t, "rtr1", map[string]string{"show interfaces": interfacesBefore})
+	post := mustSnapshot(t, "rtr1", map[string]string{"show interfaces": interfacesAfter})
+
+	var got []string
+	for _, r := range Compare(pre, post, CompareOptions{}) {
+		got = append(got, r.Severity.String()+" "+r.Result)
+	}
+	want := []string{
+		"warning GigabitEthernet0/1: CRC errors increased from 3 to 7",
+		"critical GigabitEthernet0/2: went down, admin \"up\" protocol \"down\"",
+	}
+	if diff := deep.Equal(got, want); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestCompareMissingDevice(t *testing.T) {
+	pre := mustSnapshot(t, "rtr1", map[string]string{"show interfaces": interfacesBefore})
+
+	got := Compare(pre, New(), CompareOptions{})
+	if len(got) != 1 || got[0].Severity != checks.Critical {
+		t.Errorf("expected one critical result for a missing device, got %v", got)
+	}
+}
+
+func TestSaveLoad(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "pre.json")
+
+	pre := mustSnapshot(t, "rtr1", map[string]string{"show bgp sum": bgpBefore, "show interfaces": interfacesBefore})
+	if err := pre.Save(fn); err != nil {
+		t.Fatalf("failed to save snapshot: %v", err)
+	}
+	loaded, err := Load(fn)
+	if err != nil {
+		t.Fatalf("failed to load snapshot: %v", err)
+	}
+
+	// A snapshot compared to itself after a round trip should have no differences.
+	if got := Compare(loaded, pre, CompareOptions{}); len(got) != 0 {
+		t.Errorf("expected no differences after save and load, got %v", got)
+	}
+}
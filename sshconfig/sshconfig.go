@@ -0,0 +1,430 @@
+// Package sshconfig reads the OpenSSH client configuration, ~/.ssh/config, so devices can be reached the same way ssh
+// reaches them.
+//
+// It supports Host and Match blocks with wildcards and negation, Include, and the HostName, Port, User, IdentityFile
+// and ProxyJump keywords. Other keywords are ignored. Like ssh, the first value that is found for a keyword wins, except
+// for IdentityFile, of which all values are used.
+package sshconfig
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"os/user"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// maxIncludeDepth limits nested Includes, to stop include loops.
+const maxIncludeDepth = 16
+
+// criterion is a criterion of a Match block, like "host rtr-*".
+type criterion struct {
+	negate   bool
+	name     string
+	patterns string
+}
+
+// block is a Host or Match block, or the directives before the first one, which apply to all hosts.
+type block struct {
+	// hosts are the patterns of a Host block.
+	hosts []string
+	// match are the criteria of a Match block.
+	match []criterion
+	// options are the keywords, in lower case, and their arguments, in order.
+	options [][2]string
+}
+
+// Config is a parsed OpenSSH client configuration.
+type Config struct {
+	blocks []*block
+	// localUser is the user running cpush, for Match localuser and %u.
+	localUser string
+	home      string
+}
+
+// Host is the configuration of a host.
+type Host struct {
+	// Name is the name that was looked up.
+	Name     string
+	HostName string
+	// Port is the port to connect to, or 0 for the default.
+	Port          int
+	User          string
+	IdentityFiles []string
+	// ProxyJump are the jump hosts to connect through, like user@bastion,bastion2:2222. It's empty for none.
+	ProxyJump string
+}
+
+// Address returns the host and port to connect to.
+func (h Host) Address() string {
+	port := h.Port
+	if port == 0 {
+		port = 22
+	}
+	return net.JoinHostPort(h.HostName, strconv.Itoa(port))
+}
+
+// PublicKeys returns the keys in the identity files as auth method, or nil if there are none. Files that can't be
+// read or parsed, for example because they're protected with a passphrase, are skipped.
+func (h Host) PublicKeys() []ssh.AuthMethod {
+	var signers []ssh.Signer
+	for _, fn := range h.IdentityFiles {
+		data, err := os.ReadFile(fn)
+		if err != nil {
+			continue
+		}
+		signer, err := ssh.ParsePrivateKey(data)
+		if err != nil {
+			continue
+		}
+		signers = append(signers, signer)
+	}
+	if len(signers) == 0 {
+		return nil
+	}
+	return []ssh.AuthMethod{ssh.PublicKeys(signers...)}
+}
+
+// Load reads an OpenSSH client configuration file. Relative Includes are relative to the directory of the file.
+func Load(fn string) (*Config, error) {
+	c := &Config{}
+	if u, err := user.Current(); err == nil {
+		c.localUser = u.Username
+		c.home = u.HomeDir
+	}
+	if err := c.parseFile(fn, filepath.Dir(fn), &block{}, 0); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Open reads the configuration file fn, which can start with ~/. An empty fn is ~/.ssh/config, which doesn't have to
+// exist. "none" means no configuration, and returns nil.
+func Open(fn string) (*Config, error) {
+	switch fn {
+	case "none":
+		return nil, nil
+	case "":
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, nil
+		}
+		fn = filepath.Join(home, ".ssh", "config")
+		if _, err := os.Stat(fn); os.IsNotExist(err) {
+			return nil, nil
+		}
+	}
+	if strings.HasPrefix(fn, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			fn = filepath.Join(home, fn[2:])
+		}
+	}
+	return Load(fn)
+}
+
+// parseFile parses a file into the blocks. Directives before the first Host or Match in the file belong to current,
+// which is the block that included the file.
+func (c *Config) parseFile(fn string, dir string, current *block, depth int) error {
+	if depth > maxIncludeDepth {
+		return fmt.Errorf("too many nested Includes in %q", fn)
+	}
+	f, err := os.Open(fn)
+	if err != nil {
+		return fmt.Errorf("failed to read ssh config %q: %v", fn, err)
+	}
+	defer f.Close()
+
+	cur := current
+	c.blocks = append(c.blocks, cur)
+
+	scanner := bufio.NewScanner(f)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		keyword, args, err := splitLine(scanner.Text())
+		if err != nil {
+			return fmt.Errorf("%s line %d: %v", fn, lineNumber, err)
+		}
+		if keyword == "" {
+			continue
+		}
+
+		switch keyword {
+		case "host":
+			cur = &block{hosts: args}
+			c.blocks = append(c.blocks, cur)
+		case "match":
+			criteria, err := parseMatch(args)
+			if err != nil {
+				return fmt.Errorf("%s line %d: %v", fn, lineNumber, err)
+			}
+			cur = &block{match: criteria}
+			c.blocks = append(c.blocks, cur)
+		case "include":
+			for _, pattern := range args {
+				pattern = c.expandHome(pattern)
+				if !filepath.IsAbs(pattern) {
+					pattern = filepath.Join(dir, pattern)
+				}
+				files, err := filepath.Glob(pattern)
+				if err != nil {
+					return fmt.Errorf("%s line %d: invalid Include %q: %v", fn, lineNumber, pattern, err)
+				}
+				for _, inc := range files {
+					// The included file continues the current block, until it starts its own.
+					if err := c.parseFile(inc, dir, &block{hosts: cur.hosts, match: cur.match}, depth+1); err != nil {
+						return err
+					}
+				}
+			}
+			// Directives after the Include are in the current block again, after everything that was included.
+			cur = &block{hosts: cur.hosts, match: cur.match}
+			c.blocks = append(c.blocks, cur)
+		default:
+			if len(args) == 0 {
+				return fmt.Errorf("%s line %d: %s without a value", fn, lineNumber, keyword)
+			}
+			cur.options = append(cur.options, [2]string{keyword, strings.Join(args, " ")})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read ssh config %q: %v", fn, err)
+	}
+	return nil
+}
+
+// splitLine splits a line into the keyword, in lower case, and its arguments. Arguments can be quoted. The keyword
+// can be followed by "=".
+func splitLine(line string) (string, []string, error) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return "", nil, nil
+	}
+	end := strings.IndexAny(line, " \t=")
+	if end < 0 {
+		return strings.ToLower(line), nil, nil
+	}
+	keyword := strings.ToLower(line[:end])
+	rest := strings.TrimSpace(line[end:])
+	rest = strings.TrimSpace(strings.TrimPrefix(rest, "="))
+
+	var args []string
+	for rest != "" {
+		if rest[0] == '"' {
+			quote := strings.Index(rest[1:], `"`)
+			if quote < 0 {
+				return "", nil, fmt.Errorf("unterminated quote")
+			}
+			args = append(args, rest[1:quote+1])
+			rest = strings.TrimSpace(rest[quote+2:])
+			continue
+		}
+		if rest[0] == '#' {
+			break
+		}
+		end := strings.IndexAny(rest, " \t")
+		if end < 0 {
+			end = len(rest)
+		}
+		args = append(args, rest[:end])
+		rest = strings.TrimSpace(rest[end:])
+	}
+	return keyword, args, nil
+}
+
+// parseMatch parses the criteria of a Match line.
+func parseMatch(args []string) ([]criterion, error) {
+	var result []criterion
+	for i := 0; i < len(args); i++ {
+		c := criterion{name: strings.ToLower(args[i])}
+		if strings.HasPrefix(c.name, "!") {
+			c.negate = true
+			c.name = c.name[1:]
+		}
+		switch c.name {
+		case "all", "canonical", "final":
+		case "host", "originalhost", "user", "localuser", "exec":
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("no value for Match %s", c.name)
+			}
+			i++
+			c.patterns = args[i]
+		default:
+			return nil, fmt.Errorf("unsupported Match criterion %q", c.name)
+		}
+		result = append(result, c)
+	}
+	return result, nil
+}
+
+// matchList matches a name against lists of comma-separated patterns with * and ? wildcards, ignoring case. A
+// pattern starting with "!" excludes the names it matches.
+func matchList(name string, patterns []string) bool {
+	name = strings.ToLower(name)
+	matched := false
+	for _, p := range patterns {
+		for _, p := range strings.Split(strings.ToLower(p), ",") {
+			negate := strings.HasPrefix(p, "!")
+			p = strings.TrimPrefix(p, "!")
+			// path.Match has character classes and escapes, which ssh patterns don't have.
+			p = strings.NewReplacer(`\`, `\\`, "[", `\[`).Replace(p)
+			ok, _ := path.Match(p, name)
+			if ok && negate {
+				return false
+			}
+			if ok {
+				matched = true
+			}
+		}
+	}
+	return matched
+}
+
+// applies returns true if a block applies to a host. hostName is the HostName found so far, and user the User.
+func (c *Config) applies(b *block, original string, hostName string, user string) bool {
+	if b.hosts != nil {
+		return matchList(original, b.hosts)
+	}
+	if b.match == nil {
+		return true
+	}
+	for _, m := range b.match {
+		var ok bool
+		switch m.name {
+		case "all", "final":
+			ok = true
+		case "canonical":
+			ok = false
+		case "exec":
+			// cpush doesn't run commands from the ssh config.
+			ok = false
+		case "host":
+			ok = matchList(hostName, []string{m.patterns})
+		case "originalhost":
+			ok = matchList(original, []string{m.patterns})
+		case "user":
+			ok = matchList(user, []string{m.patterns})
+		case "localuser":
+			ok = matchList(c.localUser, []string{m.patterns})
+		}
+		if ok == m.negate {
+			return false
+		}
+	}
+	return true
+}
+
+// Lookup returns the configuration for a host. The host can have a port, like rtr-1:2222, which wins over the
+// configured port. A nil configuration returns the host as is.
+func (c *Config) Lookup(host string) Host {
+	h := Host{Name: host, HostName: host}
+	if name, port, err := net.SplitHostPort(host); err == nil {
+		h.Name, h.HostName = name, name
+		h.Port, _ = strconv.Atoi(port)
+	}
+	if c == nil {
+		return h
+	}
+
+	var hostName, userName, port, proxyJump string
+	for _, b := range c.blocks {
+		current := h.Name
+		if hostName != "" {
+			current = c.expand(hostName, h.Name, "")
+		}
+		if !c.applies(b, h.Name, current, userName) {
+			continue
+		}
+		for _, o := range b.options {
+			switch o[0] {
+			case "hostname":
+				if hostName == "" {
+					hostName = o[1]
+				}
+			case "port":
+				if port == "" {
+					port = o[1]
+				}
+			case "user":
+				if userName == "" {
+					userName = o[1]
+				}
+			case "proxyjump":
+				if proxyJump == "" {
+					proxyJump = o[1]
+				}
+			case "identityfile":
+				h.IdentityFiles = append(h.IdentityFiles, o[1])
+			}
+		}
+	}
+
+	if hostName != "" {
+		h.HostName = c.expand(hostName, h.Name, "")
+	}
+	if h.Port == 0 && port != "" {
+		h.Port, _ = strconv.Atoi(port)
+	}
+	h.User = userName
+	if proxyJump != "none" {
+		h.ProxyJump = proxyJump
+	}
+	for i, fn := range h.IdentityFiles {
+		h.IdentityFiles[i] = c.expandHome(c.expand(fn, h.Name, userName))
+	}
+	return h
+}
+
+// ProxyJump resolves the jump hosts of a ProxyJump, which can be aliases in the configuration, into a list of
+// user@host:port. Jump hosts without a user in the ProxyJump or the configuration get defaultUser.
+func (c *Config) ProxyJump(spec string, defaultUser string) string {
+	var result []string
+	for _, hop := range strings.Split(spec, ",") {
+		hop = strings.TrimPrefix(strings.TrimSpace(hop), "ssh://")
+		if hop == "" {
+			continue
+		}
+		hopUser := ""
+		if i := strings.LastIndex(hop, "@"); i >= 0 {
+			hopUser, hop = hop[:i], hop[i+1:]
+		}
+		h := c.Lookup(hop)
+		if hopUser == "" {
+			hopUser = h.User
+		}
+		if hopUser == "" {
+			hopUser = defaultUser
+		}
+		result = append(result, hopUser+"@"+h.Address())
+	}
+	return strings.Join(result, ",")
+}
+
+// expand replaces the tokens %h (the host), %r (the remote user), %u (the local user), %d (the home directory) and
+// %% in a value.
+func (c *Config) expand(value string, host string, remoteUser string) string {
+	if !strings.Contains(value, "%") {
+		return value
+	}
+	return strings.NewReplacer(
+		"%%", "%",
+		"%h", host,
+		"%r", remoteUser,
+		"%u", c.localUser,
+		"%d", c.home,
+	).Replace(value)
+}
+
+// expandHome replaces a leading ~ with the home directory.
+func (c *Config) expandHome(fn string) string {
+	if c.home != "" && (fn == "~" || strings.HasPrefix(fn, "~/")) {
+		return filepath.Join(c.home, fn[1:])
+	}
+	return fn
+}
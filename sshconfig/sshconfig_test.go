@@ -0,0 +1,68 @@
+package sshconfig
+
+import (
+	"testing"
+
+	"github.com/go-test/deep"
+)
+
+func TestLookup(t *testing.T) {
+	c, err := Load("testdata/config")
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+	c.home = "/home/me"
+
+	for _, test := range []struct {
+		Host string
+		Want Host
+	}{
+		{"rtr-1", Host{Name: "rtr-1", HostName: "10.0.0.1", Port: 2222, User: "netops"}},
+		{"rtr-2:22", Host{Name: "rtr-2", HostName: "rtr-2", Port: 22, User: "netops"}},
+		{"rtr-9", Host{Name: "rtr-9", HostName: "rtr-9", User: "fallback"}},
+		{"sw-1", Host{Name: "sw-1", HostName: "sw-1", User: "netops", ProxyJump: "bastion,admin@bastion2"}},
+		{"core.lab", Host{Name: "core.lab", HostName: "core.lab.example.com", User: "fallback",
+			IdentityFiles: []string{"/home/me/.ssh/lab_fallback", "/etc/keys/lab key"}}},
+		{"RTR-3", Host{Name: "RTR-3", HostName: "RTR-3", Port: 2222, User: "netops"}},
+	} {
+		if diff := deep.Equal(c.Lookup(test.Host), test.Want); diff != nil {
+			t.Errorf("Lookup(%q): %v", test.Host, diff)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	c, err := Load("testdata/config")
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+	// Match user applies to the User found in earlier blocks.
+	c.blocks = append([]*block{{hosts: []string{"*.lab"}, options: [][2]string{{"user", "netops"}}}}, c.blocks...)
+	if got := c.Lookup("core.lab").Port; got != 2200 {
+		t.Errorf("got port %d, want 2200 from the Match block", got)
+	}
+}
+
+func TestProxyJump(t *testing.T) {
+	c, err := Load("testdata/config")
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+	h := c.Lookup("sw-1")
+	if got, want := c.ProxyJump(h.ProxyJump, "me"), "jumper@bastion.example.com:2022,admin@bastion2:22"; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+}
+
+func TestNilConfig(t *testing.T) {
+	var c *Config
+	if got, want := c.Lookup("rtr-1").Address(), "rtr-1:22"; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+	if got, want := c.Lookup("2001:db8::1").Address(), "[2001:db8::1]:22"; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+	if got, want := c.Lookup("rtr-1:2222").Address(), "rtr-1:2222"; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+}
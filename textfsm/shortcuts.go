@@ -1,7 +1,26 @@
 package textfsm
 
 
-const CiscoIosShowBgpSummaryTemplate = "# Carry down the local end information so that it is present on each row item.\nValue Filldown RouterID (\\S+)\nValue Filldown LocalAS (\\d+)\nValue RemoteAS (\\d+)\nValue Required RemoteIP (\\d+(\\.\\d+){3})\nValue Uptime (\\d+\\S+)\nValue Received_V4 (\\d+)\nValue Status (\\D.*)\n\nStart\n  ^BGP router identifier ${RouterID}, local AS number ${LocalAS}\n  ^${RemoteIP}\\s+\\d+\\s+${RemoteAS}(\\s+\\S+){5}\\s+${Uptime}\\s+${Received_V4} -> Record\n  ^${RemoteIP}\\s+\\d+\\s+${RemoteAS}(\\s+\\S+){5}\\s+${Uptime}\\s+${Status} -> Record\n\n# Last record is already recorded then skip doing so here.\nEOF"
+const CiscoIosShowBfdNeighborTemplate = "Value Required NEIGHBOR (\\S+)\nValue LD (\\d+)\nValue RD (\\d+)\nValue RH_RS (\\S+)\nValue STATE (\\S+)\nValue INTERFACE (\\S+)\n\nStart\n  ^${NEIGHBOR}\\s+${LD}/${RD}\\s+${RH_RS}\\s+${STATE}\\s+${INTERFACE}\\s*$$ -> Record\n"
+
+func ParseCiscoIosShowBfdNeighbor(input string)  ([]map[string]interface{}, error) {
+	return Parse(CiscoIosShowBfdNeighborTemplate, input, true)
+}
+type CiscoIosShowBfdNeighborRow struct { 
+	Interface string
+	Ld string
+	Neighbor string
+	Rd string
+	RhRs string
+	State string
+}
+
+func ParseTypedCiscoIosShowBfdNeighbor(input string) ([]CiscoIosShowBfdNeighborRow, error) {
+	result, err := ParseIntoStruct([]CiscoIosShowBfdNeighborRow{}, CiscoIosShowBfdNeighborTemplate, input, true)
+	return result.([]CiscoIosShowBfdNeighborRow), err
+}
+
+const CiscoIosShowBgpSummaryTemplate = "# Carry down the local end information so that it is present on each row item.\nValue Filldown RouterID (\\S+)\nValue Filldown LocalAS (\\d+)\nValue RemoteAS (\\d+)\nValue Required RemoteIP (\\d+(\\.\\d+){3})\nValue Uptime (\\d+\\S+|never)\nValue Received_V4 (\\d+)\nValue Status (\\D.*)\n\nStart\n  ^BGP router identifier ${RouterID}, local AS number ${LocalAS}\n  ^${RemoteIP}\\s+\\d+\\s+${RemoteAS}(\\s+\\S+){5}\\s+${Uptime}\\s+${Received_V4} -> Record\n  ^${RemoteIP}\\s+\\d+\\s+${RemoteAS}(\\s+\\S+){5}\\s+${Uptime}\\s+${Status} -> Record\n\n# Last record is already recorded then skip doing so here.\nEOF"
 
 func ParseCiscoIosShowBgpSummary(input string)  ([]map[string]interface{}, error) {
 	return Parse(CiscoIosShowBgpSummaryTemplate, input, true)
@@ -21,6 +40,22 @@ func ParseTypedCiscoIosShowBgpSummary(input string) ([]CiscoIosShowBgpSummaryRow
 	return result.([]CiscoIosShowBgpSummaryRow), err
 }
 
+const CiscoIosShowBootvarTemplate = "Value BOOT (.*?)\nValue CONFIG_REGISTER (0x[0-9a-fA-F]+)\nValue NEXT_CONFIG_REGISTER (0x[0-9a-fA-F]+)\n\nStart\n  ^BOOT\\s+variable\\s+=\\s+${BOOT};?\\s*$$\n  ^Config(uration)?\\s+register\\s+is\\s+${CONFIG_REGISTER}\\s+\\(will\\s+be\\s+${NEXT_CONFIG_REGISTER}\\s+at\\s+next\\s+reload\\)\n  ^Config(uration)?\\s+register\\s+is\\s+${CONFIG_REGISTER}\n"
+
+func ParseCiscoIosShowBootvar(input string)  ([]map[string]interface{}, error) {
+	return Parse(CiscoIosShowBootvarTemplate, input, true)
+}
+type CiscoIosShowBootvarRow struct { 
+	Boot string
+	ConfigRegister string
+	NextConfigRegister string
+}
+
+func ParseTypedCiscoIosShowBootvar(input string) ([]CiscoIosShowBootvarRow, error) {
+	result, err := ParseIntoStruct([]CiscoIosShowBootvarRow{}, CiscoIosShowBootvarTemplate, input, true)
+	return result.([]CiscoIosShowBootvarRow), err
+}
+
 const CiscoIosShowInterfacesTemplate = "Value Required interface (\\S+)\nValue link_status (.+?)\nValue protocol_status (.+?)\nValue hardware_type ([\\w ]+)\nValue mac_address ([a-fA-F0-9]{4}\\.[a-fA-F0-9]{4}\\.[a-fA-F0-9]{4})\nValue bia_mac_address ([a-fA-F0-9]{4}\\.[a-fA-F0-9]{4}\\.[a-fA-F0-9]{4})\nValue description (.+?)\nValue ip (\\d+\\.\\d+\\.\\d+\\.\\d+)\nValue prefixlen (\\d+)\nValue mtu (\\d+)\nValue duplex (([Ff]ull|[Aa]uto|[Hh]alf|[Aa]-).*?)\nValue speed (.*?)\nValue media_type (\\S+.*)\nValue bandwidth (\\d+\\s+\\w+)\nValue delay (\\d+\\s+\\S+)\nValue encapsulation (.+?)\nValue last_input (.+?)\nValue last_output (.+?)\nValue last_output_hang (.+?)\nValue queue_strategy (.+)\nValue input_rate (\\d+)\nValue output_rate (\\d+)\nValue input_pps (\\d+)\nValue output_pps (\\d+)\nValue input_packets (\\d+)\nValue output_packets (\\d+)\nValue runts (\\d+)\nValue giants (\\d+)\nValue input_errors (\\d+)\nValue crc (\\d+)\nValue frame (\\d+)\nValue overrun (\\d+)\nValue abort (\\d+)\nValue output_errors (\\d+)\nValue vlan_id (\\d+)\nValue vlan_id_inner (\\d+)\nValue vlan_id_outer (\\d+)\n\nStart\n  ^\\S+\\s+is\\s+.+?,\\s+line\\s+protocol.*$$ -> Continue.Record\n  ^${interface}\\s+is\\s+${link_status},\\s+line\\s+protocol\\s+is\\s+${protocol_status}\\s*$$\n  ^\\s+Hardware\\s+is\\s+${hardware_type} -> Continue\n  ^.+address\\s+is\\s+${mac_address}\\s+\\(bia\\s+${bia_mac_address}\\)\\s*$$\n  ^\\s+Description:\\s+${description}\\s*$$\n  ^\\s+Internet\\s+address\\s+is\\s+${ip}\\/${prefixlen}\\s*$$\n  ^\\s+MTU\\s+${mtu}.*BW\\s+${bandwidth}.*DLY\\s+${delay},\\s*$$\n  ^\\s+Encapsulation\\s+${encapsulation}, Vlan ID\\s+${vlan_id}.+$$\n  ^\\s+Encapsulation\\s+${encapsulation}, outer ID\\s+${vlan_id_outer}, inner ID\\s+${vlan_id_inner}.+$$\n  ^\\s+Encapsulation\\s+${encapsulation},.+$$\n  ^\\s+Last\\s+input\\s+${last_input},\\s+output\\s+${last_output},\\s+output\\s+hang\\s+${last_output_hang}\\s*$$\n  ^\\s+Queueing\\s+strategy:\\s+${queue_strategy}\\s*$$\n  ^\\s+${duplex},\\s+${speed},.+media\\stype\\sis\\s${media_type}$$\n  ^\\s+${duplex},\\s+${speed},.+TX/FX$$\n  ^\\s+${duplex},\\s+${speed}$$\n  ^.*input\\s+rate\\s+${input_rate}\\s+\\w+/sec,\\s+${input_pps}\\s+packets.+$$\n  ^.*output\\s+rate\\s+${output_rate}\\s+\\w+/sec,\\s+${output_pps}\\s+packets.+$$\n  ^\\s+${input_packets}\\s+packets\\s+input,\\s+\\d+\\s+bytes,\\s+\\d+\\s+no\\s+buffer\\s*$$\n  ^\\s+${runts}\\s+runts,\\s+${giants}\\s+giants,\\s+\\d+\\s+throttles\\s*$$\n  ^\\s+${input_errors}\\s+input\\s+errors,\\s+${crc}\\s+(crc|CRC),\\s+${frame}\\s+frame,\\s+${overrun}\\s+overrun,\\s+\\d+\\s+ignored\\s*$$\n  ^\\s+${input_errors}\\s+input\\s+errors,\\s+${crc}\\s+(crc|CRC),\\s+${frame}\\s+frame,\\s+${overrun}\\s+overrun,\\s+\\d+\\s+ignored,\\s+${abort}\\s+abort\\s*$$\n  ^\\s+${output_packets}\\s+packets\\s+output,\\s+\\d+\\s+bytes,\\s+\\d+\\s+underruns\\s*$$\n  ^\\s+${output_errors}\\s+output\\s+errors,\\s+\\d+\\s+collisions,\\s+\\d+\\s+interface\\s+resets\\s*$$\n  # Capture time-stamp if vty line has command time-stamping turned on\n  ^Load\\s+for\\s+\n  ^Time\\s+source\\s+is\n"
 
 func ParseCiscoIosShowInterfaces(input string)  ([]map[string]interface{}, error) {
@@ -71,6 +106,67 @@ func ParseTypedCiscoIosShowInterfaces(input string) ([]CiscoIosShowInterfacesRow
 	return result.([]CiscoIosShowInterfacesRow), err
 }
 
+const CiscoIosShowInterfacesTransceiverTemplate = "# Values can be followed by an alarm flag: ++ high alarm, + high warning, - low warning, -- low alarm.\nValue Required PORT (\\S+)\nValue TEMPERATURE (-?[\\d.]+|N/?A)\nValue VOLTAGE (-?[\\d.]+|N/?A)\nValue CURRENT (-?[\\d.]+|N/?A)\nValue TX_POWER (-?[\\d.]+|N/?A)\nValue TX_FLAG ([+-]+)\nValue RX_POWER (-?[\\d.]+|N/?A)\nValue RX_FLAG ([+-]+)\n\nStart\n  ^${PORT}\\s+${TEMPERATURE}(\\s+[+-]+)?\\s+${VOLTAGE}(\\s+[+-]+)?\\s+${CURRENT}(\\s+[+-]+)?\\s+${TX_POWER}(\\s+${TX_FLAG})?\\s+${RX_POWER}(\\s+${RX_FLAG})?\\s*$$ -> Record\n"
+
+func ParseCiscoIosShowInterfacesTransceiver(input string)  ([]map[string]interface{}, error) {
+	return Parse(CiscoIosShowInterfacesTransceiverTemplate, input, true)
+}
+type CiscoIosShowInterfacesTransceiverRow struct { 
+	Current string
+	Port string
+	RxFlag string
+	RxPower string
+	Temperature string
+	TxFlag string
+	TxPower string
+	Voltage string
+}
+
+func ParseTypedCiscoIosShowInterfacesTransceiver(input string) ([]CiscoIosShowInterfacesTransceiverRow, error) {
+	result, err := ParseIntoStruct([]CiscoIosShowInterfacesTransceiverRow{}, CiscoIosShowInterfacesTransceiverTemplate, input, true)
+	return result.([]CiscoIosShowInterfacesTransceiverRow), err
+}
+
+const CiscoIosShowLicenseAllTemplate = "# Handles both the classic license store output and the smart licensing \"License Usage\" section.\nValue Required FEATURE (\\S+)\nValue TYPE (.+?)\nValue STATE (.+?)\nValue PERIOD_LEFT (.+?)\nValue STATUS (.+?)\n\nStart\n  ^License\\s+Usage -> Usage\n  ^(Store)?Index:?\\s+\\d+\\s+Feature:\\s+\\S+ -> Continue.Record\n  ^(Store)?Index:?\\s+\\d+\\s+Feature:\\s+${FEATURE}\n  ^\\s+License\\s+Type:\\s+${TYPE}\\s*$$\n  ^\\s+License\\s+State:\\s+${STATE}\\s*$$\n  ^\\s+(Evaluation\\s+)?[Pp]eriod\\s+left:\\s+${PERIOD_LEFT}\\s*$$\n\nUsage\n  ^\\S+\\s+\\(.*\\):\\s*$$ -> Continue.Record\n  ^${FEATURE}\\s+\\(.*\\):\\s*$$\n  ^\\s+Status:\\s+${STATUS}\\s*$$\n"
+
+func ParseCiscoIosShowLicenseAll(input string)  ([]map[string]interface{}, error) {
+	return Parse(CiscoIosShowLicenseAllTemplate, input, true)
+}
+type CiscoIosShowLicenseAllRow struct { 
+	Feature string
+	PeriodLeft string
+	State string
+	Status string
+	Type string
+}
+
+func ParseTypedCiscoIosShowLicenseAll(input string) ([]CiscoIosShowLicenseAllRow, error) {
+	result, err := ParseIntoStruct([]CiscoIosShowLicenseAllRow{}, CiscoIosShowLicenseAllTemplate, input, true)
+	return result.([]CiscoIosShowLicenseAllRow), err
+}
+
+const CiscoIosShowStandbyTemplate = "Value Required INTERFACE (\\S+)\nValue Required GROUP (\\d+)\nValue STATE (\\S+)\nValue VIRTUAL_IP (\\S+)\nValue PREEMPT (enabled|disabled)\nValue ACTIVE_ROUTER (\\S+)\nValue ACTIVE_PRIORITY (\\d+)\nValue STANDBY_ROUTER (\\S+)\nValue PRIORITY (\\d+)\n\nStart\n  ^\\S+\\s+-\\s+Group\\s+\\d+ -> Continue.Record\n  ^${INTERFACE}\\s+-\\s+Group\\s+${GROUP}\n  ^\\s+State\\s+is\\s+${STATE}\n  ^\\s+Virtual\\s+IP\\s+address\\s+is\\s+${VIRTUAL_IP}\n  ^\\s+Preemption\\s+${PREEMPT}\n  ^\\s+Active\\s+router\\s+is\\s+${ACTIVE_ROUTER},\\s+priority\\s+${ACTIVE_PRIORITY}\n  ^\\s+Active\\s+router\\s+is\\s+${ACTIVE_ROUTER}\n  ^\\s+Standby\\s+router\\s+is\\s+${STANDBY_ROUTER},\n  ^\\s+Standby\\s+router\\s+is\\s+${STANDBY_ROUTER}\n  ^\\s+Priority\\s+${PRIORITY}\n"
+
+func ParseCiscoIosShowStandby(input string)  ([]map[string]interface{}, error) {
+	return Parse(CiscoIosShowStandbyTemplate, input, true)
+}
+type CiscoIosShowStandbyRow struct { 
+	ActivePriority string
+	ActiveRouter string
+	Group string
+	Interface string
+	Preempt string
+	Priority string
+	StandbyRouter string
+	State string
+	VirtualIp string
+}
+
+func ParseTypedCiscoIosShowStandby(input string) ([]CiscoIosShowStandbyRow, error) {
+	result, err := ParseIntoStruct([]CiscoIosShowStandbyRow{}, CiscoIosShowStandbyTemplate, input, true)
+	return result.([]CiscoIosShowStandbyRow), err
+}
+
 const ExampleTemplate = "Value Heading ([^\\s].*)\nValue List Detail (.*)\n\nStart\n  ^${Heading} -> heading\n\nheading\n  ^\\s${Detail}\n  # If you find a new heading, don't yet read it into the \"heading\" field, first record it.\n  ^.* -> Continue.Record\n  ^${Heading}\n"
 
 func ParseExample(input string)  ([]map[string]interface{}, error) {
@@ -911,3 +911,113 @@ func TestShowBgpSum(t *testing.T) {
 		log.Printf("got: %#v", got)
 	}
 }
+
+func TestShowBootvar(t *testing.T) {
+	data := ReadFile("testdata/cisco_ios_show_bootvar", t)
+
+	got, err := ParseTypedCiscoIosShowBootvar(data)
+	if err != nil {
+		t.Errorf("textfsm failed to execute: %v", err)
+	}
+
+	want := []CiscoIosShowBootvarRow{
+		{Boot: "bootflash:isr4300-universalk9.16.09.05.SPA.bin,12", ConfigRegister: "0x2102", NextConfigRegister: "0x2142"},
+	}
+
+	if diff := deep.Equal(got, want); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestShowBfdNeighbor(t *testing.T) {
+	data := ReadFile("testdata/cisco_ios_show_bfd_neighbor", t)
+
+	got, err := ParseTypedCiscoIosShowBfdNeighbor(data)
+	if err != nil {
+		t.Errorf("textfsm failed to execute: %v", err)
+	}
+
+	want := []CiscoIosShowBfdNeighborRow{
+		{Interface: "Gi0/0/0", Ld: "1", Neighbor: "10.01.134.2", Rd: "5", RhRs: "Up", State: "Up"},
+		{Interface: "Gi0/0/1", Ld: "2", Neighbor: "10.11.194.69", Rd: "6", RhRs: "Up", State: "Up"},
+		{Interface: "Gi0/0/2.55", Ld: "4", Neighbor: "10.121.64.122", Rd: "65628", RhRs: "Up", State: "Up"},
+		{Interface: "Gi0/0/2.66", Ld: "3", Neighbor: "10.121.17.26", Rd: "196682", RhRs: "Up", State: "Up"},
+	}
+
+	if diff := deep.Equal(got, want); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestShowInterfacesTransceiver(t *testing.T) {
+	data := ReadFile("testdata/cisco_ios_show_interfaces_transceiver", t)
+
+	got, err := ParseTypedCiscoIosShowInterfacesTransceiver(data)
+	if err != nil {
+		t.Errorf("textfsm failed to execute: %v", err)
+	}
+
+	want := []CiscoIosShowInterfacesTransceiverRow{
+		{Current: "35.3", Port: "Te1/1/1", RxPower: "-3.1", Temperature: "30.2", TxPower: "-2.3", Voltage: "3.29"},
+		{Current: "34.9", Port: "Te1/1/2", RxFlag: "-", RxPower: "-17.9", Temperature: "31.0", TxPower: "-2.5", Voltage: "3.28"},
+		{Current: "35.1", Port: "Te1/1/3", RxFlag: "--", RxPower: "-40.0", Temperature: "29.8", TxPower: "-2.4", Voltage: "3.30"},
+		{Current: "36.0", Port: "Te1/1/4", RxPower: "N/A", Temperature: "33.4", TxFlag: "--", TxPower: "-12.0", Voltage: "3.27"},
+	}
+
+	if diff := deep.Equal(got, want); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestShowLicenseAll(t *testing.T) {
+	tests := []struct {
+		DataFn string
+		Want   []CiscoIosShowLicenseAllRow
+	}{
+		{
+			"testdata/cisco_ios_show_license_all",
+			[]CiscoIosShowLicenseAllRow{
+				{Feature: "ipbasek9", State: "Active, In Use", Type: "Permanent"},
+				{Feature: "securityk9", PeriodLeft: "2  weeks 3  days", State: "Active, In Use", Type: "EvalRightToUse"},
+				{Feature: "uck9", PeriodLeft: "0  minute  0  second", State: "Inactive, Evaluation period expired", Type: "Evaluation"},
+			},
+		},
+		{
+			"testdata/cisco_ios_show_license_all_smart",
+			[]CiscoIosShowLicenseAllRow{
+				{Feature: "network-advantage", Status: "AUTHORIZED"},
+				{Feature: "dna-advantage", Status: "EVAL EXPIRED"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		got, err := ParseTypedCiscoIosShowLicenseAll(ReadFile(test.DataFn, t))
+		if err != nil {
+			t.Errorf("textfsm failed to execute on %q: %v", test.DataFn, err)
+		}
+
+		if diff := deep.Equal(got, test.Want); diff != nil {
+			t.Errorf("%s: %v", test.DataFn, diff)
+		}
+	}
+}
+
+func TestShowStandby(t *testing.T) {
+	data := ReadFile("testdata/cisco_ios_show_standby", t)
+
+	got, err := ParseTypedCiscoIosShowStandby(data)
+	if err != nil {
+		t.Errorf("textfsm failed to execute: %v", err)
+	}
+
+	want := []CiscoIosShowStandbyRow{
+		{ActiveRouter: "local", Group: "10", Interface: "Vlan10", Preempt: "enabled", Priority: "110", StandbyRouter: "10.10.10.3", State: "Active", VirtualIp: "10.10.10.1"},
+		{ActivePriority: "100", ActiveRouter: "10.20.20.3", Group: "20", Interface: "Vlan20", Preempt: "enabled", Priority: "120", StandbyRouter: "local", State: "Standby", VirtualIp: "10.20.20.1"},
+		{ActiveRouter: "unknown", Group: "30", Interface: "Vlan30", Preempt: "disabled", Priority: "100", StandbyRouter: "unknown", State: "Init", VirtualIp: "10.30.30.1"},
+	}
+
+	if diff := deep.Equal(got, want); diff != nil {
+		t.Error(diff)
+	}
+}
@@ -0,0 +1,287 @@
+// Package transcript records sessions with devices, for proof of what was typed and what the device answered.
+//
+// Transcripts are in the asciinema v2 format, so they can be played back with asciinema as well as with cpush replay:
+// a JSON header on the first line, followed by one JSON array per line for every chunk of data, with the time in
+// seconds since the start, "i" for what was sent to the device or "o" for what the device answered, and the data. The
+// header also has the device, the operator and the hash of the configlet that was pushed.
+package transcript
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// Header describes a session.
+type Header struct {
+	Version   int               `json:"version"`
+	Width     int               `json:"width"`
+	Height    int               `json:"height"`
+	Timestamp int64             `json:"timestamp"`
+	Title     string            `json:"title,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+
+	Device   string `json:"device"`
+	Operator string `json:"operator"`
+	// Operation is what the session was for, like cmd, push or interactive.
+	Operation string `json:"operation"`
+	// Command is the command that was run, for cmd.
+	Command string `json:"command,omitempty"`
+	// ConfigletSHA256 is the hash of the configlet that was pushed, for push.
+	ConfigletSHA256 string `json:"configlet_sha256,omitempty"`
+}
+
+// Event is a chunk of data that was sent or received.
+type Event struct {
+	// Time is the time since the start of the session.
+	Time time.Duration
+	// Type is "i" for input sent to the device, "o" for output from the device.
+	Type string
+	Data string
+}
+
+// Hash returns the hash of a configlet, for Header.ConfigletSHA256.
+func Hash(configlet string) string {
+	sum := sha256.Sum256([]byte(configlet))
+	return hex.EncodeToString(sum[:])
+}
+
+// Recorder writes a transcript. A nil recorder records nothing, so it can be used when transcripts aren't wanted. It's
+// safe for concurrent use.
+type Recorder struct {
+	fn    string
+	start time.Time
+
+	mu     sync.Mutex
+	f      *os.File
+	w      *bufio.Writer
+	err    error
+	closed bool
+}
+
+var unsafeChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// Create starts a transcript in dir, named after the time, the device and the operation. It returns a nil recorder
+// if dir is empty. The operator is the current user if the header doesn't have one, and the terminal size is 80x50 if
+// it has none.
+func Create(dir string, h Header) (*Recorder, error) {
+	if dir == "" {
+		return nil, nil
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create transcript directory: %v", err)
+	}
+
+	now := time.Now()
+	h.Version = 2
+	h.Timestamp = now.Unix()
+	if h.Width == 0 || h.Height == 0 {
+		h.Width, h.Height = 80, 50
+	}
+	if h.Operator == "" {
+		if u, err := user.Current(); err == nil {
+			h.Operator = u.Username
+		}
+	}
+	if h.Title == "" {
+		h.Title = fmt.Sprintf("%s on %s by %s", h.Operation, h.Device, h.Operator)
+	}
+
+	name := fmt.Sprintf("%s-%s-%s.cast", now.UTC().Format("20060102T150405.000Z"), unsafeChars.ReplaceAllString(h.Device, "_"), h.Operation)
+	fn := filepath.Join(dir, name)
+	f, err := os.OpenFile(fn, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create transcript: %v", err)
+	}
+	r := &Recorder{fn: fn, start: now, f: f, w: bufio.NewWriter(f)}
+	header, err := json.Marshal(h)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	r.w.Write(header)
+	r.w.WriteByte('\n')
+	return r, nil
+}
+
+// Name returns the file name of the transcript.
+func (r *Recorder) Name() string {
+	if r == nil {
+		return ""
+	}
+	return r.fn
+}
+
+// record adds an event to the transcript.
+func (r *Recorder) record(typ string, data []byte) {
+	if r == nil || len(data) == 0 {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil || r.closed {
+		return
+	}
+	event, err := json.Marshal([]interface{}{time.Since(r.start).Seconds(), typ, string(data)})
+	if err != nil {
+		r.err = err
+		return
+	}
+	r.w.Write(event)
+	if err := r.w.WriteByte('\n'); err != nil {
+		r.err = err
+	}
+}
+
+// Resize records that the terminal changed size.
+func (r *Recorder) Resize(width int, height int) {
+	r.record("r", []byte(fmt.Sprintf("%dx%d", width, height)))
+}
+
+// Close writes the rest of the transcript to disk. It returns the first error that happened while recording.
+func (r *Recorder) Close() error {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+	if err := r.w.Flush(); err != nil && r.err == nil {
+		r.err = err
+	}
+	if err := r.f.Close(); err != nil && r.err == nil {
+		r.err = err
+	}
+	if r.err != nil {
+		return fmt.Errorf("failed to write transcript %q: %v", r.fn, r.err)
+	}
+	return nil
+}
+
+// Input returns a writer that records what is written to w as sent to the device.
+func (r *Recorder) Input(w io.Writer) io.Writer {
+	if r == nil {
+		return w
+	}
+	return &recordingWriter{w, r, "i"}
+}
+
+// Output returns a writer that records what is written to w as answered by the device.
+func (r *Recorder) Output(w io.Writer) io.Writer {
+	if r == nil {
+		return w
+	}
+	return &recordingWriter{w, r, "o"}
+}
+
+// InputReader returns a reader that records what is read from rd as sent to the device.
+func (r *Recorder) InputReader(rd io.Reader) io.Reader {
+	if r == nil {
+		return rd
+	}
+	return &recordingReader{rd, r}
+}
+
+type recordingWriter struct {
+	w   io.Writer
+	r   *Recorder
+	typ string
+}
+
+func (w *recordingWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.r.record(w.typ, p[:n])
+	return n, err
+}
+
+type recordingReader struct {
+	rd io.Reader
+	r  *Recorder
+}
+
+func (rr *recordingReader) Read(p []byte) (int, error) {
+	n, err := rr.rd.Read(p)
+	rr.r.record("i", p[:n])
+	return n, err
+}
+
+// Load reads a transcript.
+func Load(fn string) (*Header, []Event, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	s := bufio.NewScanner(f)
+	s.Buffer(nil, 16*1024*1024)
+	if !s.Scan() {
+		return nil, nil, fmt.Errorf("transcript %q is empty", fn)
+	}
+	var h Header
+	if err := json.Unmarshal(s.Bytes(), &h); err != nil || h.Version != 2 {
+		return nil, nil, fmt.Errorf("%q isn't an asciinema v2 transcript", fn)
+	}
+
+	var events []Event
+	for line := 2; s.Scan(); line++ {
+		var raw []interface{}
+		if err := json.Unmarshal(s.Bytes(), &raw); err != nil || len(raw) != 3 {
+			return nil, nil, fmt.Errorf("%s:%d: invalid event", fn, line)
+		}
+		t, ok1 := raw[0].(float64)
+		typ, ok2 := raw[1].(string)
+		data, ok3 := raw[2].(string)
+		if !ok1 || !ok2 || !ok3 {
+			return nil, nil, fmt.Errorf("%s:%d: invalid event", fn, line)
+		}
+		events = append(events, Event{time.Duration(t * float64(time.Second)), typ, data})
+	}
+	if err := s.Err(); err != nil {
+		return nil, nil, err
+	}
+	return &h, events, nil
+}
+
+// Play writes the output of a transcript to w with its original timing, sped up by speed. Pauses are cut to maxIdle
+// if it's not zero.
+func Play(ctx context.Context, w io.Writer, events []Event, speed float64, maxIdle time.Duration) error {
+	if speed <= 0 {
+		speed = 1
+	}
+	var last time.Duration
+	for _, e := range events {
+		if e.Type != "o" {
+			continue
+		}
+		wait := e.Time - last
+		last = e.Time
+		if maxIdle > 0 && wait > maxIdle {
+			wait = maxIdle
+		}
+		if wait > 0 {
+			select {
+			case <-time.After(time.Duration(float64(wait) / speed)):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		if _, err := io.WriteString(w, e.Data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package transcript
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+)
+
+func TestRecordAndLoad(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "transcripts")
+	r, err := Create(dir, Header{
+		Device:          "rtr1:22",
+		Operator:        "alice",
+		Operation:       "push",
+		ConfigletSHA256: Hash("interface Lo0\n"),
+	})
+	if err != nil {
+		t.Fatalf("failed to create: %v", err)
+	}
+	if !strings.HasSuffix(r.Name(), "-rtr1_22-push.cast") {
+		t.Errorf("unexpected transcript name %q", r.Name())
+	}
+
+	var sent, received bytes.Buffer
+	io.WriteString(r.Output(&received), "rtr1#")
+	io.WriteString(r.Input(&sent), "show clock\r")
+	io.Copy(io.Discard, r.InputReader(strings.NewReader("exit\r")))
+	io.WriteString(r.Output(&received), "\"12:00\"\r\n")
+	r.Resize(120, 40)
+	if err := r.Close(); err != nil {
+		t.Fatalf("failed to close: %v", err)
+	}
+	if sent.String() != "show clock\r" || received.String() != "rtr1#\"12:00\"\r\n" {
+		t.Errorf("data wasn't passed on: sent %q, received %q", sent.String(), received.String())
+	}
+
+	fi, err := os.Stat(r.Name())
+	if err != nil {
+		t.Fatalf("failed to stat: %v", err)
+	}
+	if fi.Mode().Perm() != 0600 {
+		t.Errorf("transcript has mode %v, want 0600", fi.Mode().Perm())
+	}
+
+	h, events, err := Load(r.Name())
+	if err != nil {
+		t.Fatalf("failed to load: %v", err)
+	}
+	if h.Version != 2 || h.Device != "rtr1:22" || h.Operator != "alice" || h.ConfigletSHA256 != Hash("interface Lo0\n") {
+		t.Errorf("unexpected header %+v", h)
+	}
+	var got []string
+	for i, e := range events {
+		got = append(got, e.Type+" "+e.Data)
+		if i > 0 && e.Time < events[i-1].Time {
+			t.Errorf("event %d is earlier than the one before it", i)
+		}
+	}
+	want := []string{"o rtr1#", "i show clock\r", "i exit\r", "o \"12:00\"\r\n", "r 120x40"}
+	if diff := deep.Equal(got, want); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestNilRecorder(t *testing.T) {
+	r, err := Create("", Header{Device: "rtr1"})
+	if err != nil || r != nil {
+		t.Fatalf("got %v, %v, want no recorder without a directory", r, err)
+	}
+	var b bytes.Buffer
+	io.WriteString(r.Output(&b), "x")
+	io.WriteString(r.Input(&b), "y")
+	r.Resize(80, 24)
+	if err := r.Close(); err != nil {
+		t.Errorf("failed to close: %v", err)
+	}
+	if b.String() != "xy" {
+		t.Errorf("got %q, want %q", b.String(), "xy")
+	}
+}
+
+func TestPlay(t *testing.T) {
+	events := []Event{
+		{0, "o", "rtr1#"},
+		{100 * time.Millisecond, "i", "show clock\r"},
+		{time.Hour, "o", "12:00\r\n"},
+	}
+	var b bytes.Buffer
+	start := time.Now()
+	if err := Play(context.Background(), &b, events, 2, 100*time.Millisecond); err != nil {
+		t.Fatalf("failed to play: %v", err)
+	}
+	if b.String() != "rtr1#12:00\r\n" {
+		t.Errorf("got %q, want only the output", b.String())
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("playing took %v, the pause wasn't cut", elapsed)
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "bad.cast")
+	os.WriteFile(fn, []byte("{\"version\": 1}\n"), 0600)
+	if _, _, err := Load(fn); err == nil {
+		t.Errorf("expected an error for a version 1 file")
+	}
+}
@@ -2,6 +2,7 @@ package utils
 
 import (
 	"os"
+	"sort"
 	"strings"
 	"time"
 )
@@ -130,3 +131,13 @@ func Dos2Unix(s string) string {
 
 	return result
 }
+
+// SortedKeys returns the keys of a map, sorted.
+func SortedKeys[V any](m map[string]V) []string {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}